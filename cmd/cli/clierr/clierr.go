@@ -0,0 +1,60 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+// Package clierr defines the kinds of error returned by idp-cli commands and the exit code of each kind. Errors are
+// wrapped with a kind, e.g. fmt.Errorf("%w: workspace %s", clierr.ErrNotFound, name), and identified with errors.Is.
+package clierr
+
+import (
+	"errors"
+)
+
+var (
+	// ErrConfig is a required parameter that is not set, or a parameter or config file that is not valid
+	ErrConfig = errors.New("configuration error")
+
+	// ErrNotFound is a workspace, variable, or other resource that does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrAPI is a failed call to the Terraform Cloud, DNS provider, or AWS API
+	ErrAPI = errors.New("API request failed")
+
+	// ErrPartialFailure is an operation that was only partly completed, e.g. some Terraform runs or DNS changes failed
+	ErrPartialFailure = errors.New("partial failure")
+
+	// ErrAborted is an operation that was not started because the operator did not confirm it or a safety check
+	// failed, or that was interrupted by the operator
+	ErrAborted = errors.New("aborted")
+)
+
+// Exit codes
+const (
+	ExitOK             = 0
+	ExitError          = 1
+	ExitConfig         = 2
+	ExitNotFound       = 3
+	ExitAPI            = 4
+	ExitPartialFailure = 5
+	ExitAborted        = 6
+)
+
+// ExitCode returns the exit code for an error. If an error has more than one kind, the first in the order aborted,
+// partial failure, configuration, not found, and API failure is used.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrAborted):
+		return ExitAborted
+	case errors.Is(err, ErrPartialFailure):
+		return ExitPartialFailure
+	case errors.Is(err, ErrConfig):
+		return ExitConfig
+	case errors.Is(err, ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrAPI):
+		return ExitAPI
+	}
+	return ExitError
+}
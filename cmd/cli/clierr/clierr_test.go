@@ -0,0 +1,30 @@
+package clierr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"nil":       {nil, ExitOK},
+		"other":     {errors.New("failed"), ExitError},
+		"config":    {fmt.Errorf("%w: parameter idp is not set", ErrConfig), ExitConfig},
+		"not found": {fmt.Errorf("workspace: %w", ErrNotFound), ExitNotFound},
+		"api":       {fmt.Errorf("%w: status 500", ErrAPI), ExitAPI},
+		"partial":   {fmt.Errorf("%w: 1 of 3 runs failed", ErrPartialFailure), ExitPartialFailure},
+		"aborted":   {ErrAborted, ExitAborted},
+		"multiple":  {fmt.Errorf("%w: %w", ErrAPI, ErrNotFound), ExitNotFound},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package flags
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -9,19 +10,36 @@ import (
 
 // Root-level persistent flags
 const (
-	Config       = "config"
-	Org          = "org"
-	Idp          = "idp"
-	Region       = "region"
-	ReadOnlyMode = "read-only-mode"
+	Config         = "config"
+	Org            = "org"
+	Idp            = "idp"
+	Region         = "region"
+	ReadOnlyMode   = "read-only-mode"
+	Output         = "output"
+	Yes            = "yes"
+	NonInteractive = "non-interactive"
+
+	ApiMaxAttempts = "api-max-attempts"
+	ApiTimeout     = "api-timeout"
+
+	AuditLog = "audit-log"
 )
 
 // Persistent flags for multiregion commands
 const (
-	DomainName = "domain-name"
-	Env        = "env"
-	Region2    = "region2"
-	TfcToken   = "tfc-token"
+	DnsProvider = "dns-provider"
+	DomainName  = "domain-name"
+	Env         = "env"
+	Region2     = "region2"
+	TfcToken    = "tfc-token"
+
+	WorkspaceNameTemplate = "workspace-name-template"
+)
+
+// Flags for the multiregion setup command
+const (
+	SecretsSource = "secrets-source"
+	SecretsFile   = "secrets-file"
 )
 
 func NewStringFlag(command *cobra.Command, name, shorthand string, value, usage string) {
@@ -48,3 +66,27 @@ func NewBoolFlag(command *cobra.Command, name, shorthand string, value bool, usa
 		log.Fatalln("Error: unable to bind flag:", err)
 	}
 }
+
+func NewIntFlag(command *cobra.Command, name, shorthand string, value int, usage string) {
+	var i int
+	if shorthand == "" {
+		command.PersistentFlags().IntVar(&i, name, value, usage)
+	} else {
+		command.PersistentFlags().IntVarP(&i, name, shorthand, value, usage)
+	}
+	if err := viper.BindPFlag(name, command.PersistentFlags().Lookup(name)); err != nil {
+		log.Fatalln("Error: unable to bind flag:", err)
+	}
+}
+
+func NewDurationFlag(command *cobra.Command, name, shorthand string, value time.Duration, usage string) {
+	var d time.Duration
+	if shorthand == "" {
+		command.PersistentFlags().DurationVar(&d, name, value, usage)
+	} else {
+		command.PersistentFlags().DurationVarP(&d, name, shorthand, value, usage)
+	}
+	if err := viper.BindPFlag(name, command.PersistentFlags().Lookup(name)); err != nil {
+		log.Fatalln("Error: unable to bind flag:", err)
+	}
+}
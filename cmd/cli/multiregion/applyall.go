@@ -0,0 +1,330 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+type applyAllOptions struct {
+	secondary bool
+	message   string
+	timeout   time.Duration
+}
+
+// ApplyAllResult is the result of the apply-all command
+type ApplyAllResult struct {
+	// Waves lists the workspaces that can be applied at the same time, in the order the waves are started
+	Waves [][]string  `json:"waves" yaml:"waves"`
+	Runs  []RunResult `json:"runs,omitempty" yaml:"runs,omitempty"`
+}
+
+func InitApplyAllCmd(parentCmd *cobra.Command) {
+	var opts applyAllOptions
+
+	applyAllCmd := &cobra.Command{
+		Use:   "apply-all",
+		Short: "Apply all workspaces in dependency order",
+		Long: `Start a run on every workspace of the IdP in the order given by the remote state dependencies in the
+workspace catalog. Independent workspaces are run at the same time, and a workspace is only run after all of its
+dependencies have applied successfully. If a run fails, the workspaces that depend on it are not run. When the last
+dependency to apply has a run trigger to a workspace, the run started by the trigger is used instead of starting
+another, waiting up to two minutes for it to appear. Use --secondary to only run the secondary workspaces,
+e.g. to bring up a new secondary region.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runApplyAll(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), pFlags, opts)
+		},
+	}
+
+	parentCmd.AddCommand(applyAllCmd)
+
+	applyAllCmd.PersistentFlags().BoolVar(&opts.secondary, "secondary", false,
+		`only run the secondary workspaces`,
+	)
+	applyAllCmd.PersistentFlags().StringVar(&opts.message, "message", "apply-all by idp-cli",
+		`message for the Terraform runs`,
+	)
+	applyAllCmd.PersistentFlags().DurationVar(&opts.timeout, "timeout", defaultRunTimeout,
+		`maximum time to wait for all Terraform runs to finish`,
+	)
+}
+
+func runApplyAll(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags, opts applyAllOptions) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
+	}
+
+	a, err := newApplyAll(tfc, pFlags, opts.secondary)
+	if err != nil {
+		return err
+	}
+	result := ApplyAllResult{Waves: a.waves()}
+
+	_, _ = fmt.Fprintln(pFlags.progress, "\nRun order:")
+	for i, wave := range result.Waves {
+		_, _ = fmt.Fprintf(pFlags.progress, "  %d: %s\n", i+1, strings.Join(wave, ", "))
+	}
+
+	if pFlags.readOnlyMode || len(a.workspaces) == 0 {
+		output.Print(result)
+		return nil
+	}
+
+	if !confirm(pFlags, "Please confirm runs on all of these workspaces.") {
+		return clierr.ErrAborted
+	}
+
+	result.Runs, err = a.run(ctx, opts.message, time.Now().Add(opts.timeout))
+	output.Print(result)
+	return err
+}
+
+// triggeredRunWait is the maximum time to wait for a run trigger to start a run after a dependency has applied
+var triggeredRunWait = 2 * time.Minute
+
+// applyAll runs the workspaces of an IdP in dependency order
+type applyAll struct {
+	tfc      TerraformCloud
+	progress io.Writer
+
+	// workspaces is a list of the names of the workspaces to run, in catalog order
+	workspaces []string
+
+	// workspaceIDs is a map of workspace names (key) and IDs (value)
+	workspaceIDs map[string]string
+
+	// dependencies is a map of workspace names (key) and the names of the workspaces to run before them (value)
+	dependencies map[string][]string
+
+	// triggerSources is a map of workspace names (key) and the names of the workspaces with a run trigger to them
+	// (value)
+	triggerSources map[string][]string
+}
+
+func newApplyAll(tfc TerraformCloud, pFlags PersistentFlags, secondaryOnly bool) (*applyAll, error) {
+	workspaceIDs, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+	a := &applyAll{
+		tfc:            tfc,
+		progress:       pFlags.progress,
+		workspaceIDs:   workspaceIDs,
+		dependencies:   map[string][]string{},
+		triggerSources: map[string][]string{},
+	}
+
+	c := pFlags.catalog
+	for _, w := range c.workspaces {
+		name := workspaceName(pFlags, w.Key)
+		if secondaryOnly && !c.isSecondary(w.Key) {
+			continue
+		}
+		if _, ok := a.workspaceIDs[name]; !ok {
+			_, _ = fmt.Fprintf(pFlags.progress, "%s - workspace does not exist, skipping\n", name)
+			continue
+		}
+		a.workspaces = append(a.workspaces, name)
+	}
+
+	// dependencies that are not run are considered to be applied already
+	for _, w := range c.workspaces {
+		name := workspaceName(pFlags, w.Key)
+		for _, key := range c.dependencies(w.Key) {
+			if dependency := workspaceName(pFlags, key); slices.Contains(a.workspaces, dependency) {
+				a.dependencies[name] = append(a.dependencies[name], dependency)
+			}
+		}
+	}
+
+	for _, trigger := range getRunTriggers(pFlags) {
+		a.triggerSources[trigger.workspace] = append(a.triggerSources[trigger.workspace], trigger.source)
+	}
+	return a, nil
+}
+
+// waves groups the workspaces by the length of the longest chain of dependencies before them. The workspaces of a
+// wave do not depend on each other.
+func (a *applyAll) waves() [][]string {
+	depth := map[string]int{}
+	var waves [][]string
+	for _, workspace := range a.workspaces {
+		d := 0
+		for _, dependency := range a.dependencies[workspace] {
+			d = max(d, depth[dependency]+1)
+		}
+		depth[workspace] = d
+		if d == len(waves) {
+			waves = append(waves, nil)
+		}
+		waves[d] = append(waves[d], workspace)
+	}
+	return waves
+}
+
+// applyAllState is the progress of one workspace during an apply-all
+type applyAllState struct {
+	run     Run
+	started bool
+	result  *RunResult
+
+	// triggerDeadline is the time to stop waiting for a run trigger and start a run, if one is expected
+	triggerDeadline time.Time
+}
+
+// run starts each workspace run as soon as all of its dependencies have applied, and waits for all runs to finish.
+// The results are returned in catalog order, with an error if any workspace was not applied successfully.
+func (a *applyAll) run(ctx context.Context, message string, deadline time.Time) ([]RunResult, error) {
+	_, _ = fmt.Fprintln(a.progress, "\nStarting runs...")
+
+	states := map[string]*applyAllState{}
+	for _, workspace := range a.workspaces {
+		states[workspace] = &applyAllState{}
+	}
+
+	for {
+		active := 0
+		for _, workspace := range a.workspaces {
+			s := states[workspace]
+			if s.result == nil && !s.started {
+				a.start(workspace, s, states, message)
+			}
+			if s.result == nil && s.started {
+				a.poll(workspace, s)
+			}
+			if s.result == nil {
+				active++
+			}
+		}
+
+		if active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			for _, workspace := range a.workspaces {
+				if s := states[workspace]; s.result == nil {
+					s.result = &RunResult{Workspace: workspace, RunID: s.run.ID, Status: s.run.Status,
+						Error: "timed out waiting for the run to finish"}
+				}
+			}
+			break
+		}
+		if err := waitToPoll(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]RunResult, 0, len(a.workspaces))
+	for _, workspace := range a.workspaces {
+		results = append(results, *states[workspace].result)
+	}
+	return results, printRunResults(a.progress, results)
+}
+
+// start starts the run on a workspace if all of its dependencies have applied. If a dependency was not applied, the
+// workspace is given a result without a run. If the last dependency to finish was applied and has a run trigger to
+// the workspace, the triggered run is used, waiting up to triggeredRunWait for it to be started before starting a run.
+// A run with no changes to apply does not fire its run triggers.
+func (a *applyAll) start(workspace string, s *applyAllState, states map[string]*applyAllState, message string) {
+	var after time.Time
+	var last string
+	for _, dependency := range a.dependencies[workspace] {
+		d := states[dependency]
+		if d.result == nil {
+			return
+		}
+		if d.result.Error != "" {
+			s.result = &RunResult{Workspace: workspace, Error: "not run because " + dependency + " was not applied"}
+			return
+		}
+		if d.run.appliedAt().After(after) {
+			after = d.run.appliedAt()
+			last = dependency
+		}
+	}
+
+	if s.triggerDeadline.IsZero() && slices.Contains(a.triggerSources[workspace], last) &&
+		states[last].run.Status == runStatusApplied {
+		_, _ = fmt.Fprintf(a.progress, "  %s: waiting for a run trigger from %s\n", workspace, last)
+		s.triggerDeadline = time.Now().Add(triggeredRunWait)
+	}
+	if !s.triggerDeadline.IsZero() {
+		r, ok, err := a.findTriggeredRun(workspace, after)
+		if err != nil {
+			s.result = &RunResult{Workspace: workspace, Error: "failed to list runs: " + err.Error()}
+			return
+		}
+		if ok {
+			_, _ = fmt.Fprintf(a.progress, "  %s: using run %s started by a run trigger\n", workspace, r.ID)
+			s.started = true
+			s.run = r
+			return
+		}
+		if time.Now().Before(s.triggerDeadline) {
+			return
+		}
+		_, _ = fmt.Fprintf(a.progress, "  %s: no run was triggered\n", workspace)
+	}
+
+	s.started = true
+	_, _ = fmt.Fprintf(a.progress, "  %s: starting run\n", workspace)
+	r, err := a.tfc.CreateRun(a.workspaceIDs[workspace], message)
+	if err != nil {
+		s.result = &RunResult{Workspace: workspace, Error: "failed to create run: " + err.Error()}
+		return
+	}
+	s.run = r
+}
+
+// findTriggeredRun returns the first run on a workspace started by a run trigger after the given time
+func (a *applyAll) findTriggeredRun(workspace string, after time.Time) (Run, bool, error) {
+	runs, err := a.tfc.ListRuns(a.workspaceIDs[workspace])
+	if err != nil {
+		return Run{}, false, err
+	}
+	// runs are listed most recent first
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].isTriggeredAfter(after) {
+			return runs[i], true, nil
+		}
+	}
+	return Run{}, false, nil
+}
+
+// poll gets the status of a started run, printing each change in status, and sets the result when it is finished
+func (a *applyAll) poll(workspace string, s *applyAllState) {
+	status := s.run.Status
+	r, err := a.tfc.GetRun(s.run.ID)
+	if err != nil {
+		s.result = &RunResult{Workspace: workspace, RunID: s.run.ID, Status: status, Error: err.Error()}
+		return
+	}
+	s.run = r
+	if r.Status != status {
+		_, _ = fmt.Fprintf(a.progress, "  %s: %s\n", workspace, r.Status)
+	}
+	if !r.isFinished() {
+		return
+	}
+
+	s.result = &RunResult{Workspace: workspace, RunID: r.ID, Status: r.Status}
+	if !r.isSuccessful() {
+		s.result.Error = "run is " + r.Status
+	}
+}
@@ -0,0 +1,190 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+func TestApplyAllWaves(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	name := func(key string) string { return workspaceName(pFlags, key) }
+	want := [][]string{
+		{name(ClusterSecondary)},
+		{name(DatabaseSecondary)},
+		{name(PhpmyadminSecondary), name(EmailServiceSecondary)},
+		{name(IdBrokerSecondary)},
+		{name(PwManagerSecondary), name(IdSyncSecondary)},
+		{name(SimplesamlphpSecondary)},
+	}
+	a, err := newApplyAll(tfc, pFlags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := a.waves()
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("waves = %v, want %v", got, want)
+	}
+}
+
+func TestRunApplyAll(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	setStdin(t, "yes\n")
+	if err := runApplyAll(context.Background(), tfc, pFlags, applyAllOptions{message: "test", timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last run of each workspace is applied after the last run of all of its dependencies
+	a, err := newApplyAll(tfc, pFlags, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workspace := range a.workspaces {
+		runs := tfc.workspaceRuns(workspace)
+		if len(runs) == 0 || runs[len(runs)-1].Status != runStatusApplied {
+			t.Errorf("%s: expected an applied run, got %+v", workspace, runs)
+			continue
+		}
+		last := runs[len(runs)-1]
+		for _, dependency := range a.dependencies[workspace] {
+			d := tfc.workspaceRuns(dependency)
+			if len(d) == 0 || !d[len(d)-1].CreatedAt.Before(last.CreatedAt) {
+				t.Errorf("%s was run before its dependency %s", workspace, dependency)
+			}
+		}
+	}
+
+	// a run started by a run trigger from the last dependency to apply is used instead of starting another
+	if runs := tfc.workspaceRuns(workspaceName(pFlags, IdBrokerSecondary)); len(runs) != 1 {
+		t.Errorf("expected the triggered run to be used, got %+v", runs)
+	}
+}
+
+func TestApplyAllStopsDownstream(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	tfc.failRuns[workspaceName(pFlags, EmailServiceSecondary)] = true
+
+	a, err := newApplyAll(tfc, pFlags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := a.run(context.Background(), "test", time.Now().Add(time.Minute))
+	if !errors.Is(err, clierr.ErrPartialFailure) {
+		t.Errorf("expected a partial failure, got %v", err)
+	}
+
+	notRun := []string{IdBrokerSecondary, PwManagerSecondary, SimplesamlphpSecondary, IdSyncSecondary}
+	for _, r := range results {
+		runs := tfc.workspaceRuns(r.Workspace)
+		key, _ := workspaceKey(pFlags, r.Workspace)
+		switch {
+		case key == EmailServiceSecondary:
+			if r.Error == "" {
+				t.Errorf("%s: expected a failed run", r.Workspace)
+			}
+		case slices.Contains(notRun, key):
+			if len(runs) != 0 || r.Error == "" {
+				t.Errorf("%s: expected no run after the upstream failure, got %+v", r.Workspace, runs)
+			}
+		default:
+			if r.Error != "" || len(runs) != 1 {
+				t.Errorf("%s: expected one applied run, got %+v, %s", r.Workspace, runs, r.Error)
+			}
+		}
+	}
+}
+
+func TestRunApplyAllReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	pFlags.readOnlyMode = true
+
+	if err := runApplyAll(context.Background(), tfc, pFlags, applyAllOptions{message: "test", timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workspace := range secondaryWorkspaceOrder(pFlags) {
+		if runs := tfc.workspaceRuns(workspace); len(runs) != 0 {
+			t.Errorf("%s: expected no runs in read-only mode, got %d", workspace, len(runs))
+		}
+	}
+}
+
+func TestApplyAllWaitsForTriggeredRun(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	tfc.triggerDelay = 2
+
+	a, err := newApplyAll(tfc, pFlags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.run(context.Background(), "test", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := tfc.workspaceRuns(workspaceName(pFlags, IdBrokerSecondary))
+	if len(runs) != 1 || runs[0].Source != runSourceRunTrigger || runs[0].Status != runStatusApplied {
+		t.Errorf("expected only the applied triggered run, got %+v", runs)
+	}
+}
+
+func TestApplyAllListRunsError(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	tfc.failMethods["ListRuns"] = true
+
+	a, err := newApplyAll(tfc, pFlags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := a.run(context.Background(), "test", time.Now().Add(time.Minute))
+	if !errors.Is(err, clierr.ErrPartialFailure) {
+		t.Errorf("expected a partial failure, got %v", err)
+	}
+
+	// the database is the first workspace to look for a run started by a run trigger
+	database := workspaceName(pFlags, DatabaseSecondary)
+	for _, r := range results {
+		if r.Workspace == database && !strings.Contains(r.Error, "ListRuns failed") {
+			t.Errorf("%s: expected the ListRuns error as the result, got %+v", database, r)
+		}
+	}
+	if runs := tfc.workspaceRuns(database); len(runs) != 1 || runs[0].Source != runSourceRunTrigger {
+		t.Errorf("expected no run to be started on %s, got %+v", database, runs)
+	}
+}
+
+func TestApplyAllNoChangesUpstream(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	tfc.noChanges[workspaceName(pFlags, DatabaseSecondary)] = true
+
+	a, err := newApplyAll(tfc, pFlags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = a.run(context.Background(), "test", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("apply-all waited for a run trigger after a run with no changes")
+	}
+
+	// the run with no changes does not fire its run trigger, so a run is started on the downstream workspace
+	runs := tfc.workspaceRuns(workspaceName(pFlags, EmailServiceSecondary))
+	if len(runs) != 1 || runs[0].Source == runSourceRunTrigger || runs[0].Status != runStatusApplied {
+		t.Errorf("expected one applied run started by apply-all, got %+v", runs)
+	}
+}
@@ -0,0 +1,385 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+)
+
+// AuditCheck is the result of one check of the multiregion configuration
+type AuditCheck struct {
+	Workspace string `json:"workspace" yaml:"workspace"`
+	Check     string `json:"check" yaml:"check"`
+	Passed    bool   `json:"passed" yaml:"passed"`
+	Detail    string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// audit checks all workspaces for the configuration made by the setup command
+type audit struct {
+	tfc    TerraformCloud
+	pFlags PersistentFlags
+
+	// workspaceIDs is a map of workspace names (key) and IDs (value) of all existing workspaces for the IdP
+	workspaceIDs map[string]string
+
+	// variables is a map of workspace names (key) and variables (value) read from Terraform Cloud
+	variables map[string][]lib.Var
+
+	checks []AuditCheck
+}
+
+// runAudit checks the configuration of all multiregion workspaces and prints the result of each check. An error is
+// returned if the configuration cannot be read, not if a check fails.
+func runAudit(tfc TerraformCloud, pFlags PersistentFlags) ([]AuditCheck, error) {
+	a, err := newAudit(tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range []func() error{
+		a.checkSecondaryWorkspaces,
+		a.checkVariables,
+		a.checkUnusedVariables,
+		a.checkRunTriggers,
+		a.checkRemoteStateConsumers,
+	} {
+		if err = check(); err != nil {
+			return nil, err
+		}
+	}
+
+	a.printSummary()
+	return a.checks, nil
+}
+
+func newAudit(tfc TerraformCloud, pFlags PersistentFlags) (*audit, error) {
+	workspaceIDs, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+	return &audit{
+		tfc:          tfc,
+		pFlags:       pFlags,
+		workspaceIDs: workspaceIDs,
+		variables:    map[string][]lib.Var{},
+	}, nil
+}
+
+// failed returns the checks that did not pass
+func (a *audit) failed() []AuditCheck {
+	var failed []AuditCheck
+	for _, c := range a.checks {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// printSummary prints the number of checks that passed and failed
+func (a *audit) printSummary() {
+	failed := len(a.failed())
+	_, _ = fmt.Fprintf(a.pFlags.progress, "\n%d checks passed, %d checks failed\n", len(a.checks)-failed, failed)
+}
+
+// add records the result of a check and prints it
+func (a *audit) add(workspace, check string, passed bool, detail string) {
+	a.checks = append(a.checks, AuditCheck{
+		Workspace: workspace,
+		Check:     check,
+		Passed:    passed,
+		Detail:    detail,
+	})
+
+	result := "PASS"
+	if !passed {
+		result = "FAIL"
+	}
+	if detail == "" {
+		_, _ = fmt.Fprintf(a.pFlags.progress, "  [%s] %s - %s\n", result, workspace, check)
+	} else {
+		_, _ = fmt.Fprintf(a.pFlags.progress, "  [%s] %s - %s (%s)\n", result, workspace, check, detail)
+	}
+}
+
+// exists checks for the existence of a workspace, adding a failed check if it does not exist
+func (a *audit) exists(workspace, check string) bool {
+	if _, ok := a.workspaceIDs[workspace]; ok {
+		return true
+	}
+	a.add(workspace, check, false, "workspace does not exist")
+	return false
+}
+
+// existing returns the workspaces in a list that exist, without duplicates, in the order given
+func (a *audit) existing(workspaces []string) []string {
+	var found []string
+	for _, w := range workspaces {
+		if _, ok := a.workspaceIDs[w]; ok && !slices.Contains(found, w) {
+			found = append(found, w)
+		}
+	}
+	return found
+}
+
+// loadVariables reads the variables of the existing workspaces in a list concurrently, caching the results for the
+// checks that follow
+func (a *audit) loadVariables(workspaces []string) error {
+	var missing []string
+	for _, w := range a.existing(workspaces) {
+		if _, ok := a.variables[w]; !ok {
+			missing = append(missing, w)
+		}
+	}
+
+	vars, err := mapConcurrently(missing, a.listVariables)
+	if err != nil {
+		return err
+	}
+	maps.Copy(a.variables, vars)
+	return nil
+}
+
+// getVariables reads the variables of a workspace, caching the result for subsequent checks
+func (a *audit) getVariables(workspace string) ([]lib.Var, error) {
+	if vars, ok := a.variables[workspace]; ok {
+		return vars, nil
+	}
+
+	vars, err := a.listVariables(workspace)
+	if err != nil {
+		return nil, err
+	}
+	a.variables[workspace] = vars
+	return vars, nil
+}
+
+// listVariables reads the variables of a workspace from Terraform Cloud
+func (a *audit) listVariables(workspace string) ([]lib.Var, error) {
+	vars, err := a.tfc.ListVariables(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the variables from %q: %w", workspace, err)
+	}
+	return vars, nil
+}
+
+// checkSecondaryWorkspaces checks that each secondary workspace exists and has the correct working directory
+func (a *audit) checkSecondaryWorkspaces() error {
+	workspaces := secondaryWorkspaces(a.pFlags)
+	names := make([]string, 0, len(workspaces))
+	for _, key := range sortedKeys(workspaces) {
+		names = append(names, workspaces[key])
+	}
+
+	properties, err := mapConcurrently(a.existing(names), a.tfc.GetWorkspace)
+	if err != nil {
+		return err
+	}
+
+	for _, workspace := range names {
+		if !a.exists(workspace, "workspace exists") {
+			continue
+		}
+		a.add(workspace, "workspace exists", true, "")
+		data := properties[workspace]
+
+		expected, err := workingDirectory(a.pFlags, workspace)
+		if err != nil {
+			return err
+		}
+		actual := data.Attributes.WorkingDirectory
+		check := "working directory is " + expected
+		if actual == expected {
+			a.add(workspace, check, true, "")
+		} else {
+			a.add(workspace, check, false, fmt.Sprintf("found %q", actual))
+		}
+	}
+	return nil
+}
+
+// checkVariables checks that each remote state variable set by the setup command has the expected value
+func (a *audit) checkVariables() error {
+	workspaces := getMultiregionVariables(a.pFlags, nil)
+	var names []string
+	for _, w := range workspaces {
+		names = append(names, w.workspace)
+	}
+	if err := a.loadVariables(names); err != nil {
+		return err
+	}
+
+	for _, w := range workspaces {
+		for _, expected := range w.variables {
+			if !strings.HasPrefix(expected.Key, "tf_remote_") {
+				continue
+			}
+
+			check := fmt.Sprintf("var.%s is %q", expected.Key, expected.Value)
+			if !a.exists(w.workspace, check) {
+				continue
+			}
+
+			vars, err := a.getVariables(w.workspace)
+			if err != nil {
+				return err
+			}
+			v := findVar(vars, expected.Key)
+			switch {
+			case v == nil:
+				a.add(w.workspace, check, false, "variable is not set")
+			case v.Value != expected.Value:
+				a.add(w.workspace, check, false, fmt.Sprintf("found %q", v.Value))
+			default:
+				a.add(w.workspace, check, true, "")
+			}
+		}
+	}
+	return nil
+}
+
+// checkUnusedVariables checks that each variable deleted by the setup command is not present
+func (a *audit) checkUnusedVariables() error {
+	workspaces := getUnusedVariables(a.pFlags)
+	var names []string
+	for _, w := range workspaces {
+		names = append(names, w.workspace)
+	}
+	if err := a.loadVariables(names); err != nil {
+		return err
+	}
+
+	for _, w := range workspaces {
+		for _, key := range w.keys {
+			check := fmt.Sprintf("var.%s is not present", key)
+			if !a.exists(w.workspace, check) {
+				continue
+			}
+
+			vars, err := a.getVariables(w.workspace)
+			if err != nil {
+				return err
+			}
+			v := findVar(vars, key)
+			if v == nil {
+				a.add(w.workspace, check, true, "")
+			} else {
+				a.add(w.workspace, check, false, fmt.Sprintf("found %q", v.Value))
+			}
+		}
+	}
+	return nil
+}
+
+// checkRunTriggers checks that each run trigger created by the setup command is present
+func (a *audit) checkRunTriggers() error {
+	triggers := getRunTriggers(a.pFlags)
+
+	var existing []runTrigger
+	for _, trigger := range triggers {
+		_, workspaceFound := a.workspaceIDs[trigger.workspace]
+		_, sourceFound := a.workspaceIDs[trigger.source]
+		if workspaceFound && sourceFound {
+			existing = append(existing, trigger)
+		}
+	}
+	found, err := mapConcurrently(existing, func(trigger runTrigger) (bool, error) {
+		found, err := a.tfc.FindRunTrigger(a.workspaceIDs[trigger.workspace], a.workspaceIDs[trigger.source])
+		if err != nil {
+			return false, fmt.Errorf("failed to get run triggers for workspace %s: %w", trigger.workspace, err)
+		}
+		return found, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, trigger := range triggers {
+		workspace, source := trigger.workspace, trigger.source
+
+		check := "run trigger from " + source
+		if !a.exists(workspace, check) {
+			continue
+		}
+		if _, ok := a.workspaceIDs[source]; !ok {
+			a.add(workspace, check, false, "source workspace does not exist")
+			continue
+		}
+		a.add(workspace, check, found[trigger], "")
+	}
+	return nil
+}
+
+// checkRemoteStateConsumers checks that each remote state consumer added by the setup command is present. Workspaces
+// that share state globally with the organization do not need consumers.
+func (a *audit) checkRemoteStateConsumers() error {
+	workspaces := remoteStateWorkspaces(a.pFlags)
+	sharing, err := mapConcurrently(a.existing(workspaces), a.getRemoteStateSharing)
+	if err != nil {
+		return err
+	}
+
+	for _, workspace := range workspaces {
+		if !a.exists(workspace, "remote state sharing") {
+			continue
+		}
+		if sharing[workspace].global {
+			a.add(workspace, "remote state sharing", true, "shared with all workspaces in the organization")
+			continue
+		}
+
+		consumerIDs := sharing[workspace].consumerIDs
+		for _, consumer := range getWorkspaceConsumers(a.pFlags, workspace) {
+			check := "remote state consumer " + consumer
+			consumerID, ok := a.workspaceIDs[consumer]
+			if !ok {
+				a.add(workspace, check, false, "consumer workspace does not exist")
+				continue
+			}
+			a.add(workspace, check, slices.Contains(consumerIDs, consumerID), "")
+		}
+	}
+	return nil
+}
+
+// remoteStateSharing is the remote state sharing configuration of a workspace
+type remoteStateSharing struct {
+	// global is true if the state is shared with all workspaces in the organization
+	global bool
+
+	// consumerIDs lists the IDs of the workspaces allowed to read the state, if it is not shared globally
+	consumerIDs []string
+}
+
+// getRemoteStateSharing reads the remote state sharing configuration of a workspace
+func (a *audit) getRemoteStateSharing(workspace string) (remoteStateSharing, error) {
+	workspaceID := a.workspaceIDs[workspace]
+
+	global, err := a.tfc.IsGlobalRemoteState(workspaceID)
+	if err != nil || global {
+		return remoteStateSharing{global: global}, err
+	}
+
+	consumerIDs, err := a.tfc.ListRemoteStateConsumers(workspaceID)
+	if err != nil {
+		return remoteStateSharing{}, err
+	}
+	return remoteStateSharing{consumerIDs: consumerIDs}, nil
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,350 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+// Audit log actions
+const (
+	actionCreateVariable       = "create-variable"
+	actionUpdateVariable       = "update-variable"
+	actionDeleteVariable       = "delete-variable"
+	actionUpdateWorkspace      = "update-workspace"
+	actionCloneWorkspace       = "clone-workspace"
+	actionDeleteWorkspace      = "delete-workspace"
+	actionCreateRun            = "create-run"
+	actionCreateDestroyRun     = "create-destroy-run"
+	actionCreateRunTrigger     = "create-run-trigger"
+	actionDeleteRunTrigger     = "delete-run-trigger"
+	actionAddStateConsumers    = "add-remote-state-consumers"
+	actionRemoveStateConsumers = "remove-remote-state-consumers"
+	actionCreateDnsRecord      = "create-dns-record"
+	actionUpdateDnsRecord      = "update-dns-record"
+	actionLockWorkspace        = "lock-workspace"
+	actionUnlockWorkspace      = "unlock-workspace"
+	actionForceUnlockWorkspace = "force-unlock-workspace"
+)
+
+// Audit log results
+const (
+	auditResultOK     = "ok"
+	auditResultFailed = "failed"
+)
+
+// sensitiveValue is recorded in the audit log in place of the value of a sensitive variable
+const sensitiveValue = "(sensitive)"
+
+// defaultAuditLogName is the name of the audit log file in the ~/.config directory
+const defaultAuditLogName = "idp-cli-audit.jsonl"
+
+// AuditLogEntry is one mutating action recorded in the audit log
+type AuditLogEntry struct {
+	Time     time.Time `json:"time" yaml:"time"`
+	Operator string    `json:"operator" yaml:"operator"`
+	Idp      string    `json:"idp" yaml:"idp"`
+	Env      string    `json:"env" yaml:"env"`
+	Action   string    `json:"action" yaml:"action"`
+	Target   string    `json:"target" yaml:"target"`
+	OldValue string    `json:"old_value,omitempty" yaml:"old_value,omitempty"`
+	NewValue string    `json:"new_value,omitempty" yaml:"new_value,omitempty"`
+	Result   string    `json:"result" yaml:"result"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// auditLog appends a record of each mutating action to a local file in JSON lines format, one entry per line. The
+// file is only ever appended to, so it keeps a history of all commands run by the operators that share it.
+type auditLog struct {
+	filename string
+	operator string
+	idp      string
+	env      string
+
+	mu sync.Mutex
+}
+
+// defaultAuditLogFile returns the name of the audit log file used if none is specified
+func defaultAuditLogFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to find the home directory for the audit log, use --%s: %w",
+			clierr.ErrConfig, flags.AuditLog, err)
+	}
+	return filepath.Join(home, ".config", defaultAuditLogName), nil
+}
+
+// auditLogFile returns the name of the audit log file given by the 'audit-log' parameter, or the default
+func auditLogFile() (string, error) {
+	if filename := viper.GetString(flags.AuditLog); filename != "" {
+		return filename, nil
+	}
+	return defaultAuditLogFile()
+}
+
+// newAuditLog returns an audit log for the IdP and environment. The file is opened to make sure it can be written
+// before any change is made.
+func newAuditLog(pFlags PersistentFlags) (*auditLog, error) {
+	filename, err := auditLogFile()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := openAuditLog(filename)
+	if err != nil {
+		return nil, err
+	}
+	_ = f.Close()
+
+	return &auditLog{
+		filename: filename,
+		operator: operator(),
+		idp:      pFlags.idp,
+		env:      pFlags.env,
+	}, nil
+}
+
+func openAuditLog(filename string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return nil, fmt.Errorf("%w: failed to create the audit log directory: %w", clierr.ErrConfig, err)
+	}
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open the audit log: %w", clierr.ErrConfig, err)
+	}
+	return f, nil
+}
+
+// operator returns the name of the person running the command, as user@host. It is recorded in the audit log and in
+// the reason given for workspace locks.
+func operator() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	} else if env := os.Getenv("USER"); env != "" {
+		name = env
+	}
+	if host, err := os.Hostname(); err == nil {
+		return name + "@" + host
+	}
+	return name
+}
+
+// record appends an entry for an action to the audit log. A failure to write the entry is printed, but does not
+// stop the command, since the action has already been made.
+func (l *auditLog) record(action, target, oldValue, newValue string, actionErr error) {
+	e := AuditLogEntry{
+		Time:     time.Now().UTC(),
+		Operator: l.operator,
+		Idp:      l.idp,
+		Env:      l.env,
+		Action:   action,
+		Target:   target,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Result:   auditResultOK,
+	}
+	if actionErr != nil {
+		e.Result = auditResultFailed
+		e.Error = actionErr.Error()
+	}
+
+	if err := l.write(e); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: failed to write %s %s to the audit log: %s\n", action, target, err)
+	}
+}
+
+func (l *auditLog) write(e AuditLogEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := openAuditLog(l.filename)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readAuditLog reads all entries from an audit log file
+func readAuditLog(filename string) ([]AuditLogEntry, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: audit log %s does not exist", clierr.ErrNotFound, filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []AuditLogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e AuditLogEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w: audit log %s line %d is not valid: %w", clierr.ErrConfig, filename, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// auditFilter selects audit log entries
+type auditFilter struct {
+	idp    string
+	env    string
+	action string
+	since  time.Time
+	failed bool
+	limit  int
+}
+
+// apply returns the entries that match the filter, limited to the most recent entries if a limit is set
+func (f auditFilter) apply(entries []AuditLogEntry) []AuditLogEntry {
+	matched := []AuditLogEntry{}
+	for _, e := range entries {
+		switch {
+		case f.idp != "" && e.Idp != f.idp,
+			f.env != "" && e.Env != f.env,
+			f.action != "" && e.Action != f.action,
+			e.Time.Before(f.since),
+			f.failed && e.Result != auditResultFailed:
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	if f.limit > 0 && len(matched) > f.limit {
+		matched = matched[len(matched)-f.limit:]
+	}
+	return matched
+}
+
+// InitAuditCmd adds the audit command. It is a top-level command because the audit log is shared by all commands.
+func InitAuditCmd(parentCmd *cobra.Command) {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Tools for the audit log",
+		Long: `Every change made to Terraform Cloud workspaces and DNS records is recorded in an audit log file, with
+the time, operator, IdP, environment, action, target, old and new values, and result. The file is given by the
+'audit-log' parameter, by default ~/.config/` + defaultAuditLogName + `, in JSON lines format.`,
+	}
+	parentCmd.AddCommand(auditCmd)
+
+	var filter auditFilter
+	var since string
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the audit log",
+		Long: `Show the entries in the audit log, oldest first. The entries can be filtered by IdP, environment,
+action, time, and result. The IdP is only used as a filter if set.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter.idp = viper.GetString(flags.Idp)
+			if since != "" {
+				t, err := parseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+				filter.since = t
+			}
+
+			filename, err := auditLogFile()
+			if err != nil {
+				return err
+			}
+			return runAuditShow(filename, filter)
+		},
+	}
+	auditCmd.AddCommand(showCmd)
+
+	showCmd.Flags().StringVar(&filter.env, "env", "", "only show entries for this environment")
+	showCmd.Flags().StringVar(&filter.action, "action", "", "only show entries for this action, e.g. update-variable")
+	showCmd.Flags().StringVar(&since, "since", "",
+		"only show entries since this time, as a duration like 24h or a date like 2024-01-31")
+	showCmd.Flags().BoolVar(&filter.failed, "failed", false, "only show actions that failed")
+	showCmd.Flags().IntVar(&filter.limit, "limit", 0, "only show this number of the most recent entries")
+}
+
+// parseSince parses the --since value, which is either a duration before now or a date and optional time
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: --since %q is not a duration or date", clierr.ErrConfig, value)
+}
+
+func runAuditShow(filename string, filter auditFilter) error {
+	entries, err := readAuditLog(filename)
+	if err != nil {
+		return err
+	}
+	entries = filter.apply(entries)
+
+	printAuditLog(output.Progress(), entries)
+	output.Print(entries)
+	return nil
+}
+
+// printAuditLog prints a table with one row per entry
+func printAuditLog(out io.Writer, entries []AuditLogEntry) {
+	if len(entries) == 0 {
+		_, _ = fmt.Fprintln(out, "No entries found")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tOPERATOR\tIDP\tENV\tACTION\tTARGET\tCHANGE\tRESULT")
+	for _, e := range entries {
+		change := e.NewValue
+		if e.OldValue != "" {
+			change = fmt.Sprintf("%s -> %s", e.OldValue, e.NewValue)
+		}
+		result := e.Result
+		if e.Error != "" {
+			result += ": " + e.Error
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Operator,
+			e.Idp, e.Env, e.Action, e.Target, change, result)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,280 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+)
+
+// auditedTerraformCloud is a TerraformCloud that records each change in the audit log. Workspaces are recorded by
+// name, and the old value of a variable is taken from the last time the variables of its workspace were listed, so
+// no extra requests are made. Sensitive values are never recorded. It is safe for concurrent use if the wrapped
+// TerraformCloud is.
+type auditedTerraformCloud struct {
+	TerraformCloud
+	log *auditLog
+
+	mu sync.Mutex
+
+	// names is a map of workspace IDs (key) and names (value)
+	names map[string]string
+
+	// variables is a map of variable IDs (key) and the workspace name and variable (value)
+	variables map[string]auditedVariable
+}
+
+type auditedVariable struct {
+	workspace string
+	v         lib.Var
+}
+
+func newAuditedTerraformCloud(tfc TerraformCloud, log *auditLog) *auditedTerraformCloud {
+	return &auditedTerraformCloud{
+		TerraformCloud: tfc,
+		log:            log,
+		names:          map[string]string{},
+		variables:      map[string]auditedVariable{},
+	}
+}
+
+// workspaceName returns the name of a workspace seen earlier, or the ID if the name is not known
+func (a *auditedTerraformCloud) workspaceName(id string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if name, ok := a.names[id]; ok {
+		return name
+	}
+	return id
+}
+
+func (a *auditedTerraformCloud) FindWorkspaces(filter string) (map[string]string, error) {
+	workspaces, err := a.TerraformCloud.FindWorkspaces(filter)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name, id := range workspaces {
+		a.names[id] = name
+	}
+	return workspaces, err
+}
+
+func (a *auditedTerraformCloud) GetWorkspace(name string) (lib.Workspace, error) {
+	w, err := a.TerraformCloud.GetWorkspace(name)
+	if err == nil {
+		a.mu.Lock()
+		a.names[w.ID] = name
+		a.mu.Unlock()
+	}
+	return w, err
+}
+
+func (a *auditedTerraformCloud) GetWorkspaceID(name string) (string, error) {
+	id, err := a.TerraformCloud.GetWorkspaceID(name)
+	if err == nil {
+		a.mu.Lock()
+		a.names[id] = name
+		a.mu.Unlock()
+	}
+	return id, err
+}
+
+func (a *auditedTerraformCloud) ListVariables(workspace string) ([]lib.Var, error) {
+	vars, err := a.TerraformCloud.ListVariables(workspace)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, v := range vars {
+		a.variables[v.ID] = auditedVariable{workspace: workspace, v: v}
+	}
+	return vars, err
+}
+
+func (a *auditedTerraformCloud) UpdateWorkspace(name, attribute, value string) error {
+	err := a.TerraformCloud.UpdateWorkspace(name, attribute, value)
+	a.log.record(actionUpdateWorkspace, name+" "+attribute, "", value, err)
+	return err
+}
+
+func (a *auditedTerraformCloud) DeleteWorkspace(name string) error {
+	err := a.TerraformCloud.DeleteWorkspace(name)
+	a.log.record(actionDeleteWorkspace, name, "", "", err)
+	return err
+}
+
+// LockWorkspace records the lock reason as the new value
+func (a *auditedTerraformCloud) LockWorkspace(workspaceID, reason string) error {
+	err := a.TerraformCloud.LockWorkspace(workspaceID, reason)
+	a.log.record(actionLockWorkspace, a.workspaceName(workspaceID), "", reason, err)
+	return err
+}
+
+func (a *auditedTerraformCloud) UnlockWorkspace(workspaceID string, force bool) error {
+	err := a.TerraformCloud.UnlockWorkspace(workspaceID, force)
+	action := actionUnlockWorkspace
+	if force {
+		action = actionForceUnlockWorkspace
+	}
+	a.log.record(action, a.workspaceName(workspaceID), "", "", err)
+	return err
+}
+
+// CloneWorkspace records the name of the source workspace as the new value
+func (a *auditedTerraformCloud) CloneWorkspace(source, newName string) error {
+	err := a.TerraformCloud.CloneWorkspace(source, newName)
+	a.log.record(actionCloneWorkspace, newName, "", source, err)
+	return err
+}
+
+func (a *auditedTerraformCloud) CreateVariable(workspace string, tfVar lib.TFVar) error {
+	err := a.TerraformCloud.CreateVariable(workspace, tfVar)
+	a.log.record(actionCreateVariable, workspace+" var."+tfVar.Key, "", variableValue(tfVar.Value, tfVar.Sensitive),
+		err)
+	return err
+}
+
+func (a *auditedTerraformCloud) UpdateVariable(workspace, variableID string, tfVar lib.TFVar) error {
+	err := a.TerraformCloud.UpdateVariable(workspace, variableID, tfVar)
+
+	a.mu.Lock()
+	old, ok := a.variables[variableID]
+	a.mu.Unlock()
+
+	oldValue := ""
+	if ok {
+		oldValue = variableValue(old.v.Value, old.v.Sensitive)
+	}
+	a.log.record(actionUpdateVariable, workspace+" var."+tfVar.Key, oldValue,
+		variableValue(tfVar.Value, tfVar.Sensitive), err)
+	return err
+}
+
+func (a *auditedTerraformCloud) DeleteVariable(variableID string) error {
+	err := a.TerraformCloud.DeleteVariable(variableID)
+
+	a.mu.Lock()
+	old, ok := a.variables[variableID]
+	a.mu.Unlock()
+
+	if ok {
+		a.log.record(actionDeleteVariable, old.workspace+" var."+old.v.Key, variableValue(old.v.Value, old.v.Sensitive),
+			"", err)
+	} else {
+		a.log.record(actionDeleteVariable, "variable "+variableID, "", "", err)
+	}
+	return err
+}
+
+// CreateRun records the run ID and message as the new value
+func (a *auditedTerraformCloud) CreateRun(workspaceID, message string) (Run, error) {
+	run, err := a.TerraformCloud.CreateRun(workspaceID, message)
+	a.log.record(actionCreateRun, a.workspaceName(workspaceID), "", runValue(run, message), err)
+	return run, err
+}
+
+func (a *auditedTerraformCloud) CreateDestroyRun(workspaceID, message string) (Run, error) {
+	run, err := a.TerraformCloud.CreateDestroyRun(workspaceID, message)
+	a.log.record(actionCreateDestroyRun, a.workspaceName(workspaceID), "", runValue(run, message), err)
+	return run, err
+}
+
+// CreateRunTrigger records the source workspace as the new value
+func (a *auditedTerraformCloud) CreateRunTrigger(workspaceID, sourceID string) error {
+	err := a.TerraformCloud.CreateRunTrigger(workspaceID, sourceID)
+	a.log.record(actionCreateRunTrigger, a.workspaceName(workspaceID), "", a.workspaceName(sourceID), err)
+	return err
+}
+
+// DeleteRunTrigger records the source workspace as the old value
+func (a *auditedTerraformCloud) DeleteRunTrigger(workspaceID, sourceID string) error {
+	err := a.TerraformCloud.DeleteRunTrigger(workspaceID, sourceID)
+	a.log.record(actionDeleteRunTrigger, a.workspaceName(workspaceID), a.workspaceName(sourceID), "", err)
+	return err
+}
+
+// AddRemoteStateConsumers records the consumer workspaces as the new value
+func (a *auditedTerraformCloud) AddRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	err := a.TerraformCloud.AddRemoteStateConsumers(workspaceID, consumerIDs)
+	a.log.record(actionAddStateConsumers, a.workspaceName(workspaceID), "", a.workspaceNames(consumerIDs), err)
+	return err
+}
+
+// RemoveRemoteStateConsumers records the consumer workspaces as the old value
+func (a *auditedTerraformCloud) RemoveRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	err := a.TerraformCloud.RemoveRemoteStateConsumers(workspaceID, consumerIDs)
+	a.log.record(actionRemoveStateConsumers, a.workspaceName(workspaceID), a.workspaceNames(consumerIDs), "", err)
+	return err
+}
+
+// workspaceNames returns a comma-separated list of the names of the given workspaces
+func (a *auditedTerraformCloud) workspaceNames(ids []string) string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = a.workspaceName(id)
+	}
+	return strings.Join(names, ",")
+}
+
+// variableValue returns the value of a variable to record, hiding the value of a sensitive variable
+func variableValue(value string, sensitive bool) string {
+	if sensitive {
+		return sensitiveValue
+	}
+	return value
+}
+
+// runValue returns the run ID, if the run was created, and message of a run
+func runValue(run Run, message string) string {
+	if run.ID == "" {
+		return message
+	}
+	return run.ID + ": " + message
+}
+
+// auditedDNSProvider is a DNSProvider that records each change in the audit log. The old value of a record is taken
+// from the last time it was found.
+type auditedDNSProvider struct {
+	DNSProvider
+	log *auditLog
+
+	// records is a map of record names (key) and content (value)
+	records map[string]string
+}
+
+func newAuditedDNSProvider(dns DNSProvider, log *auditLog) *auditedDNSProvider {
+	return &auditedDNSProvider{
+		DNSProvider: dns,
+		log:         log,
+		records:     map[string]string{},
+	}
+}
+
+func (a *auditedDNSProvider) FindRecord(name string) (*DnsRecord, error) {
+	r, err := a.DNSProvider.FindRecord(name)
+	if r != nil {
+		a.records[r.Name] = r.Content
+	}
+	return r, err
+}
+
+func (a *auditedDNSProvider) UpdateRecord(record DnsRecord) error {
+	err := a.DNSProvider.UpdateRecord(record)
+	a.log.record(actionUpdateDnsRecord, record.Name, a.records[record.Name], record.Content, err)
+	if err == nil {
+		a.records[record.Name] = record.Content
+	}
+	return err
+}
+
+func (a *auditedDNSProvider) CreateRecord(record DnsRecord) error {
+	err := a.DNSProvider.CreateRecord(record)
+	a.log.record(actionCreateDnsRecord, record.Name, "", record.Content, err)
+	if err == nil {
+		a.records[record.Name] = record.Content
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+)
+
+// newTestAuditLog returns an audit log writing to a temporary file
+func newTestAuditLog(t *testing.T, pFlags PersistentFlags) *auditLog {
+	filename := filepath.Join(t.TempDir(), "audit.jsonl")
+	viper.Set(flags.AuditLog, filename)
+	t.Cleanup(func() { viper.Set(flags.AuditLog, nil) })
+
+	log, err := newAuditLog(pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func readTestAuditLog(t *testing.T, log *auditLog) []AuditLogEntry {
+	entries, err := readAuditLog(log.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRunFailoverAuditLog(t *testing.T) {
+	pFlags := testFlags()
+	fake := newTestAppliedIdp(t, pFlags)
+	log := newTestAuditLog(t, pFlags)
+	tfc := newAuditedTerraformCloud(newWorkspaceCache(fake), log)
+
+	setStdin(t, "test\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every workspace locked by the failover is unlocked again
+	var entries []AuditLogEntry
+	locks := map[string]int{}
+	for _, e := range readTestAuditLog(t, log) {
+		switch e.Action {
+		case actionLockWorkspace:
+			locks[e.Target]++
+		case actionUnlockWorkspace:
+			locks[e.Target]--
+		default:
+			entries = append(entries, e)
+		}
+	}
+	if len(locks) == 0 {
+		t.Error("no workspace locks were recorded")
+	}
+	for workspace, n := range locks {
+		if n != 0 {
+			t.Errorf("%s: %d more locks than unlocks recorded", workspace, n)
+		}
+	}
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d changes, want 2: %+v", len(entries), entries)
+	}
+
+	cluster := workspaceName(pFlags, ClusterSecondary)
+	v, r := entries[0], entries[1]
+	if v.Action != actionUpdateVariable || v.Target != cluster+" var."+awsFailoverActive || v.OldValue != "false" ||
+		v.NewValue != "true" || v.Result != auditResultOK {
+		t.Errorf("variable entry = %+v", v)
+	}
+	if r.Action != actionCreateRun || r.Target != cluster || r.Result != auditResultOK {
+		t.Errorf("run entry = %+v", r)
+	}
+	if v.Idp != pFlags.idp || v.Env != pFlags.env || v.Operator == "" || v.Time.IsZero() {
+		t.Errorf("entry is missing the IdP, environment, operator, or time: %+v", v)
+	}
+}
+
+func TestAuditedTerraformCloudVariables(t *testing.T) {
+	pFlags := testFlags()
+	fake := newTestIdp(pFlags)
+	log := newTestAuditLog(t, pFlags)
+	tfc := newAuditedTerraformCloud(fake, log)
+	core := workspaceName(pFlags, Core)
+
+	err := applyVariableChange(os.Stdout, tfc, SetupChange{Workspace: core, Type: changeTypeVariable,
+		Action: changeActionCreate, Key: "secret", NewValue: "password", Sensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applyVariableChange(os.Stdout, tfc, SetupChange{Workspace: core, Type: changeTypeVariable,
+		Action: changeActionDelete, Key: "aws_region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tfc.UpdateVariable(core, "var-unknown", lib.TFVar{Key: "missing", Value: "x"}); err == nil {
+		t.Fatal("expected an error updating a variable that does not exist")
+	}
+
+	want := []AuditLogEntry{
+		{Action: actionCreateVariable, Target: core + " var.secret", NewValue: sensitiveValue, Result: auditResultOK},
+		{Action: actionDeleteVariable, Target: core + " var.aws_region", OldValue: pFlags.region, Result: auditResultOK},
+		{Action: actionUpdateVariable, Target: core + " var.missing", NewValue: "x", Result: auditResultFailed},
+	}
+	entries := readTestAuditLog(t, log)
+	if len(entries) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, e := range entries {
+		w := want[i]
+		if e.Action != w.Action || e.Target != w.Target || e.OldValue != w.OldValue || e.NewValue != w.NewValue ||
+			e.Result != w.Result {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+	if entries[2].Error == "" {
+		t.Error("failed entry has no error")
+	}
+}
+
+func TestAuditedTerraformCloudWorkspaces(t *testing.T) {
+	pFlags := testFlags()
+	fake := newTestIdp(pFlags)
+	fake.failMethods["UpdateWorkspace"] = true
+	log := newTestAuditLog(t, pFlags)
+	tfc := newAuditedTerraformCloud(fake, log)
+	core := workspaceName(pFlags, Core)
+
+	id, err := tfc.GetWorkspaceID(core)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range []func() error{
+		func() error { return tfc.LockWorkspace(id, "test") },
+		func() error { return tfc.UnlockWorkspace(id, false) },
+		func() error { return tfc.LockWorkspace(id, "test") },
+		func() error { return tfc.UnlockWorkspace(id, true) },
+	} {
+		if err = call(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tfc.UpdateWorkspace(core, "working-directory", "dir"); !errors.Is(err, clierr.ErrAPI) {
+		t.Fatalf("err = %v, want ErrAPI", err)
+	}
+
+	want := []AuditLogEntry{
+		{Action: actionLockWorkspace, Target: core, NewValue: "test", Result: auditResultOK},
+		{Action: actionUnlockWorkspace, Target: core, Result: auditResultOK},
+		{Action: actionLockWorkspace, Target: core, NewValue: "test", Result: auditResultOK},
+		{Action: actionForceUnlockWorkspace, Target: core, Result: auditResultOK},
+		{Action: actionUpdateWorkspace, Target: core + " working-directory", NewValue: "dir", Result: auditResultFailed},
+	}
+	entries := readTestAuditLog(t, log)
+	if len(entries) != len(want) {
+		t.Fatalf("audit log has %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, e := range entries {
+		w := want[i]
+		if e.Action != w.Action || e.Target != w.Target || e.NewValue != w.NewValue || e.Result != w.Result {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+	if entries[4].Error == "" {
+		t.Error("failed entry has no error")
+	}
+}
+
+func TestAuditedDNSProvider(t *testing.T) {
+	pFlags := testFlags()
+	log := newTestAuditLog(t, pFlags)
+	name := "test." + testDomain
+	dns := newAuditedDNSProvider(newFakeDNSProvider(map[string]string{name: "test-us-east-1." + testDomain}), log)
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.confirmed = true
+	if err := d.setDnsRecordValues(pFlags.idp); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readTestAuditLog(t, log)
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d entries, want 2: %+v", len(entries), entries)
+	}
+	if e := entries[1]; e.Action != actionUpdateDnsRecord || e.Target != name ||
+		e.OldValue != "test-us-east-1."+testDomain || e.NewValue != "test-us-west-2."+testDomain {
+		t.Errorf("update entry = %+v", e)
+	}
+	if e := entries[0]; e.Action != actionCreateDnsRecord || e.Target != "test-pw-api."+testDomain {
+		t.Errorf("create entry = %+v", e)
+	}
+}
+
+func TestAuditLogAppend(t *testing.T) {
+	pFlags := testFlags()
+	log := newTestAuditLog(t, pFlags)
+	log.record(actionCreateRun, "a", "", "run-1", nil)
+
+	// a second command appends to the same file
+	log2, err := newAuditLog(pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log2.record(actionCreateRun, "b", "", "", errors.New("failed"))
+
+	entries := readTestAuditLog(t, log)
+	if len(entries) != 2 || entries[0].Target != "a" || entries[1].Target != "b" {
+		t.Errorf("entries = %+v, want a and b", entries)
+	}
+
+	if err = os.WriteFile(log.filename, []byte("not json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readAuditLog(log.filename); !errors.Is(err, clierr.ErrConfig) {
+		t.Errorf("err = %v, want ErrConfig for an invalid file", err)
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditLogEntry{
+		{Time: now.Add(-48 * time.Hour), Idp: "a", Env: "prod", Action: actionCreateRun, Result: auditResultOK},
+		{Time: now.Add(-2 * time.Hour), Idp: "a", Env: "stg", Action: actionUpdateVariable, Result: auditResultOK},
+		{Time: now.Add(-time.Hour), Idp: "b", Env: "prod", Action: actionCreateRun, Result: auditResultFailed},
+		{Time: now, Idp: "a", Env: "prod", Action: actionUpdateVariable, Result: auditResultOK},
+	}
+
+	tests := []struct {
+		name   string
+		filter auditFilter
+		want   []int
+	}{
+		{"all", auditFilter{}, []int{0, 1, 2, 3}},
+		{"idp", auditFilter{idp: "a"}, []int{0, 1, 3}},
+		{"env", auditFilter{idp: "a", env: "prod"}, []int{0, 3}},
+		{"action", auditFilter{action: actionCreateRun}, []int{0, 2}},
+		{"since", auditFilter{since: now.Add(-24 * time.Hour)}, []int{1, 2, 3}},
+		{"failed", auditFilter{failed: true}, []int{2}},
+		{"limit", auditFilter{limit: 2}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.filter.apply(entries)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, j := range tt.want {
+				if got[i] != entries[j] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[j])
+				}
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"24h":                  now.Add(-24 * time.Hour),
+		"2024-02-01":           time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local),
+		"2024-02-01 08:30:00":  time.Date(2024, 2, 1, 8, 30, 0, 0, time.Local),
+		"2024-02-01T08:30:00Z": time.Date(2024, 2, 1, 8, 30, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := parseSince(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseSince(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+
+	if _, err := parseSince("yesterday", now); !errors.Is(err, clierr.ErrConfig) {
+		t.Errorf("err = %v, want ErrConfig", err)
+	}
+}
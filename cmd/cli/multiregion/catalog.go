@@ -0,0 +1,255 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+// catalogSetting is the config file array of tables that replaces the default workspace catalog
+const catalogSetting = "workspaces"
+
+//go:embed default_catalog.toml
+var defaultCatalogFile []byte
+
+// CatalogWorkspace describes one Terraform workspace of an IdP and its relations to the other workspaces
+type CatalogWorkspace struct {
+	// Key is the module number and name, e.g. "010-cluster", which is also the working directory
+	Key string `mapstructure:"key" json:"key" yaml:"key"`
+
+	// Secondary is the key of the secondary workspace cloned from this workspace
+	Secondary string `mapstructure:"secondary" json:"secondary,omitempty" yaml:"secondary,omitempty"`
+
+	// RemoteState is a map of variable names (key) and the workspace keys (value) whose remote state they refer to
+	RemoteState map[string]string `mapstructure:"remote-state" json:"remote_state,omitempty" yaml:"remote_state,omitempty"`
+
+	// DependsOn are the keys of other workspaces whose remote state is used by this workspace
+	DependsOn []string `mapstructure:"depends-on" json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+
+	// UnusedVariables are variables copied from the primary workspace that are deleted from this secondary workspace
+	UnusedVariables []string `mapstructure:"unused-variables" json:"unused_variables,omitempty" yaml:"unused_variables,omitempty"`
+
+	// Consumers are the keys of the workspaces given access to the remote state of this workspace
+	Consumers []string `mapstructure:"consumers" json:"consumers,omitempty" yaml:"consumers,omitempty"`
+
+	// TriggerSources are the keys of the workspaces whose successful apply starts a run on this workspace
+	TriggerSources []string `mapstructure:"trigger-sources" json:"trigger_sources,omitempty" yaml:"trigger_sources,omitempty"`
+}
+
+// catalog is the list of workspaces of an IdP, in dependency order
+type catalog struct {
+	workspaces []CatalogWorkspace
+
+	// primaries is a map of secondary workspace keys (key) and the key of their primary workspace (value)
+	primaries map[string]string
+}
+
+func InitCatalogCmd(parentCmd *cobra.Command) {
+	catalogCmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Show the workspace catalog",
+		Long: `Show the Terraform workspaces used by the multiregion commands, including the secondary workspace of each
+primary workspace, remote state variables, remote state consumers, and run triggers. The built-in catalog
+can be replaced by listing the workspaces in the config file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadCatalog()
+			if err != nil {
+				return err
+			}
+			runCatalog(output.Progress(), c)
+			return nil
+		},
+	}
+
+	parentCmd.AddCommand(catalogCmd)
+}
+
+func runCatalog(out io.Writer, c *catalog) {
+	for _, w := range c.workspaces {
+		_, _ = fmt.Fprintln(out, w.Key)
+		if w.Secondary != "" {
+			_, _ = fmt.Fprintf(out, "  secondary: %s\n", w.Secondary)
+		}
+		for _, name := range sortedKeys(w.RemoteState) {
+			_, _ = fmt.Fprintf(out, "  remote state: var.%s = %s\n", name, w.RemoteState[name])
+		}
+		for _, dependency := range w.DependsOn {
+			_, _ = fmt.Fprintf(out, "  depends on: %s\n", dependency)
+		}
+		for _, key := range w.UnusedVariables {
+			_, _ = fmt.Fprintf(out, "  unused variable: %s\n", key)
+		}
+		for _, consumer := range w.Consumers {
+			_, _ = fmt.Fprintf(out, "  consumer: %s\n", consumer)
+		}
+		for _, source := range w.TriggerSources {
+			_, _ = fmt.Fprintf(out, "  run trigger from: %s\n", source)
+		}
+	}
+
+	output.Print(c.workspaces)
+}
+
+// loadCatalog returns the workspace catalog from the config file, or the default catalog if none is configured
+func loadCatalog() (*catalog, error) {
+	if !viper.IsSet(catalogSetting) {
+		return defaultCatalog(), nil
+	}
+
+	var workspaces []CatalogWorkspace
+	if err := viper.UnmarshalKey(catalogSetting, &workspaces); err != nil {
+		return nil, fmt.Errorf("%w: invalid %s setting in the config file: %w", clierr.ErrConfig, catalogSetting, err)
+	}
+	c, err := newCatalog(workspaces)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid workspace catalog in the config file: %w", clierr.ErrConfig, err)
+	}
+	return c, nil
+}
+
+// defaultCatalog returns the built-in catalog of the idp-in-a-box workspaces. It panics if the built-in catalog is
+// not valid, which is checked by the tests.
+func defaultCatalog() *catalog {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(bytes.NewReader(defaultCatalogFile)); err != nil {
+		panic("failed to read the default workspace catalog: " + err.Error())
+	}
+
+	var workspaces []CatalogWorkspace
+	if err := v.UnmarshalKey(catalogSetting, &workspaces); err != nil {
+		panic("failed to read the default workspace catalog: " + err.Error())
+	}
+	c, err := newCatalog(workspaces)
+	if err != nil {
+		panic("invalid default workspace catalog: " + err.Error())
+	}
+	return c
+}
+
+// newCatalog validates a list of workspaces and returns a catalog. Workspaces must be listed in dependency order:
+// remote state and run trigger sources must be listed before the workspaces that use them.
+func newCatalog(workspaces []CatalogWorkspace) (*catalog, error) {
+	c := &catalog{workspaces: workspaces, primaries: map[string]string{}}
+
+	seen := map[string]bool{}
+	for _, w := range workspaces {
+		if w.Key == "" {
+			return nil, fmt.Errorf("a workspace has no key")
+		}
+		if seen[w.Key] {
+			return nil, fmt.Errorf("workspace %s is listed more than once", w.Key)
+		}
+		for _, name := range sortedKeys(w.RemoteState) {
+			if !seen[w.RemoteState[name]] {
+				return nil, fmt.Errorf("workspace %s: remote state workspace %s of var.%s is not listed before it",
+					w.Key, w.RemoteState[name], name)
+			}
+		}
+		for _, dependency := range w.DependsOn {
+			if !seen[dependency] {
+				return nil, fmt.Errorf("workspace %s: dependency %s is not listed before it", w.Key, dependency)
+			}
+		}
+		for _, source := range w.TriggerSources {
+			if !seen[source] {
+				return nil, fmt.Errorf("workspace %s: run trigger source %s is not listed before it", w.Key, source)
+			}
+		}
+		seen[w.Key] = true
+	}
+
+	listed := map[string]bool{}
+	for _, w := range workspaces {
+		listed[w.Key] = true
+		for _, consumer := range w.Consumers {
+			if !seen[consumer] {
+				return nil, fmt.Errorf("workspace %s: remote state consumer %s is not in the catalog", w.Key, consumer)
+			}
+			if listed[consumer] {
+				return nil, fmt.Errorf("workspace %s: remote state consumer %s is not listed after it", w.Key, consumer)
+			}
+		}
+		if w.Secondary == "" {
+			continue
+		}
+		if !seen[w.Secondary] {
+			return nil, fmt.Errorf("workspace %s: secondary workspace %s is not in the catalog", w.Key, w.Secondary)
+		}
+		if primary, ok := c.primaries[w.Secondary]; ok {
+			return nil, fmt.Errorf("workspace %s is the secondary of both %s and %s", w.Secondary, primary, w.Key)
+		}
+		c.primaries[w.Secondary] = w.Key
+	}
+
+	for _, w := range workspaces {
+		if c.isSecondary(w.Key) && w.Secondary != "" {
+			return nil, fmt.Errorf("secondary workspace %s cannot have a secondary workspace", w.Key)
+		}
+	}
+
+	if !seen[Core] {
+		return nil, fmt.Errorf("the %s workspace is required", Core)
+	}
+	if !c.isSecondary(ClusterSecondary) {
+		return nil, fmt.Errorf("the %s workspace is required as a secondary workspace", ClusterSecondary)
+	}
+	return c, nil
+}
+
+// isSecondary returns true if the workspace key is the secondary of another workspace
+func (c *catalog) isSecondary(key string) bool {
+	_, ok := c.primaries[key]
+	return ok
+}
+
+// primary returns the key of the primary workspace of a secondary workspace
+func (c *catalog) primary(key string) string {
+	return c.primaries[key]
+}
+
+// dependencies returns the keys of the workspaces whose remote state is used by a workspace, in catalog order. These
+// are the workspaces named in its remote state variables and dependencies, and the workspaces that list it as a remote
+// state consumer.
+func (c *catalog) dependencies(key string) []string {
+	i := slices.IndexFunc(c.workspaces, func(w CatalogWorkspace) bool { return w.Key == key })
+	if i < 0 {
+		return nil
+	}
+	workspace := c.workspaces[i]
+
+	var keys []string
+	for _, w := range c.workspaces[:i] {
+		remoteState := false
+		for _, target := range workspace.RemoteState {
+			remoteState = remoteState || target == w.Key
+		}
+		if remoteState || slices.Contains(workspace.DependsOn, w.Key) || slices.Contains(w.Consumers, key) {
+			keys = append(keys, w.Key)
+		}
+	}
+	return keys
+}
+
+// secondaries returns the keys of the secondary workspaces in dependency order
+func (c *catalog) secondaries() []string {
+	var keys []string
+	for _, w := range c.workspaces {
+		if c.isSecondary(w.Key) {
+			keys = append(keys, w.Key)
+		}
+	}
+	return keys
+}
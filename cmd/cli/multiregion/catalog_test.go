@@ -0,0 +1,148 @@
+package multiregion
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	c := defaultCatalog()
+
+	want := []string{
+		ClusterSecondary, DatabaseSecondary, PhpmyadminSecondary, EmailServiceSecondary, IdBrokerSecondary,
+		PwManagerSecondary, SimplesamlphpSecondary, IdSyncSecondary,
+	}
+	if got := c.secondaries(); !slices.Equal(got, want) {
+		t.Errorf("secondaries = %v, want %v", got, want)
+	}
+	if got := c.primary(IdBrokerSecondary); got != IdBroker {
+		t.Errorf("primary of %s = %q, want %s", IdBrokerSecondary, got, IdBroker)
+	}
+
+	pFlags := testFlags()
+	if !slices.Contains(remoteStateWorkspaces(pFlags), workspaceName(pFlags, Simplesamlphp)) {
+		t.Errorf("%s is not a remote state workspace", Simplesamlphp)
+	}
+}
+
+func TestLoadCatalogFromConfig(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	err := v.ReadConfig(strings.NewReader(`
+[[workspaces]]
+key = "000-core"
+consumers = ["010-cluster-secondary"]
+
+[[workspaces]]
+key = "010-cluster"
+secondary = "010-cluster-secondary"
+
+[[workspaces]]
+key = "010-cluster-secondary"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set(catalogSetting, v.Get(catalogSetting))
+	t.Cleanup(func() { viper.Set(catalogSetting, nil) })
+
+	c, err := loadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.workspaces) != 3 {
+		t.Fatalf("expected 3 workspaces, got %d", len(c.workspaces))
+	}
+	if got := c.secondaries(); !slices.Equal(got, []string{ClusterSecondary}) {
+		t.Errorf("secondaries = %v, want [%s]", got, ClusterSecondary)
+	}
+}
+
+func TestNewCatalogErrors(t *testing.T) {
+	core := CatalogWorkspace{Key: Core}
+	cluster := CatalogWorkspace{Key: Cluster, Secondary: ClusterSecondary}
+	clusterSecondary := CatalogWorkspace{Key: ClusterSecondary}
+
+	tests := map[string][]CatalogWorkspace{
+		"missing key":               {core, cluster, clusterSecondary, {}},
+		"duplicate key":             {core, cluster, clusterSecondary, core},
+		"missing core":              {cluster, clusterSecondary},
+		"missing secondary cluster": {core, clusterSecondary},
+		"unknown secondary":         {core, cluster, clusterSecondary, {Key: "080-custom", Secondary: "090-other"}},
+		"unknown consumer":          {{Key: Core, Consumers: []string{"090-other"}}, cluster, clusterSecondary},
+		"remote state out of order": {
+			core, {Key: Cluster, Secondary: ClusterSecondary, RemoteState: map[string]string{"x": ClusterSecondary}},
+			clusterSecondary,
+		},
+		"trigger source out of order": {
+			core, {Key: Cluster, Secondary: ClusterSecondary, TriggerSources: []string{ClusterSecondary}},
+			clusterSecondary,
+		},
+		"secondary of a secondary": {
+			core, cluster, {Key: ClusterSecondary, Secondary: "010-cluster-tertiary"}, {Key: "010-cluster-tertiary"},
+		},
+	}
+	for name, workspaces := range tests {
+		if _, err := newCatalog(workspaces); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSetupCustomWorkspace(t *testing.T) {
+	const custom, customSecondary = "080-custom", "080-custom-secondary"
+
+	pFlags := testFlags()
+	c, err := newCatalog(append(slices.Clone(pFlags.catalog.workspaces),
+		CatalogWorkspace{Key: custom, Secondary: customSecondary},
+		CatalogWorkspace{
+			Key:             customSecondary,
+			RemoteState:     map[string]string{"tf_remote_broker_secondary": IdBrokerSecondary},
+			UnusedVariables: []string{"tf_remote_broker"},
+			TriggerSources:  []string{IdSyncSecondary},
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pFlags.catalog = c
+
+	tfc := newTestIdp(pFlags)
+	tfc.addWorkspace(workspaceName(pFlags, custom), custom, map[string]string{
+		"tf_remote_broker": pFlags.org + "/" + workspaceName(pFlags, IdBroker),
+	})
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal:            filepath.Join(t.TempDir(), "journal.json"),
+		secrets:            testSecrets(pFlags),
+		zones:              testZones,
+		setRemoteConsumers: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	secondary := workspaceName(pFlags, customSecondary)
+	w, err := tfc.GetWorkspace(secondary)
+	if err != nil {
+		t.Fatalf("custom secondary workspace was not created: %s", err)
+	}
+	if w.Attributes.WorkingDirectory != customSecondary {
+		t.Errorf("working directory = %q, want %s", w.Attributes.WorkingDirectory, customSecondary)
+	}
+	want := pFlags.org + "/" + workspaceName(pFlags, IdBrokerSecondary)
+	if got, _ := tfc.variable(secondary, "tf_remote_broker_secondary"); got != want {
+		t.Errorf("tf_remote_broker_secondary = %q, want %q", got, want)
+	}
+	if _, ok := tfc.variable(secondary, "tf_remote_broker"); ok {
+		t.Error("unused variable tf_remote_broker was not deleted")
+	}
+	found, _ := tfc.FindRunTrigger(tfc.workspaces[secondary].workspace.ID,
+		tfc.workspaces[workspaceName(pFlags, IdSyncSecondary)].workspace.ID)
+	if !found {
+		t.Error("run trigger was not created")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// cloudflareProvider is the DNSProvider implementation that calls the Cloudflare API. Requests are retried according
+// to the retry policy, and are canceled when the context is canceled.
+type cloudflareProvider struct {
+	ctx  context.Context
+	api  *cloudflare.API
+	zone *cloudflare.ResourceContainer
+}
+
+func newCloudflareProvider(ctx context.Context, w io.Writer, token, domainName string, policy retryPolicy) (DNSProvider, error) {
+	// the retry transport replaces the Cloudflare library retries, which do not honor Retry-After
+	api, err := cloudflare.NewWithAPIToken(token,
+		cloudflare.HTTPClient(&http.Client{Transport: newRetryTransport(http.DefaultTransport, policy)}),
+		cloudflare.UsingRetryPolicy(0, 0, 0),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the Cloudflare API: %w", err)
+	}
+
+	zoneID, err := api.ZoneIDByName(domainName)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = fmt.Fprintf(w, "Using domain name %s with ID %s\n", domainName, zoneID)
+
+	return &cloudflareProvider{
+		ctx:  ctx,
+		api:  api,
+		zone: cloudflare.ZoneIdentifier(zoneID),
+	}, nil
+}
+
+func (c *cloudflareProvider) FindRecord(name string) (*DnsRecord, error) {
+	r, _, err := c.api.ListDNSRecords(c.ctx, c.zone, cloudflare.ListDNSRecordsParams{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("Cloudflare API call failed to find DNS record %s: %w", name, err)
+	}
+
+	switch len(r) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &DnsRecord{
+			ID:      r[0].ID,
+			Type:    r[0].Type,
+			Name:    r[0].Name,
+			Content: r[0].Content,
+			Comment: r[0].Comment,
+			TTL:     r[0].TTL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("found %d DNS records named %s", len(r), name)
+	}
+}
+
+func (c *cloudflareProvider) UpdateRecord(record DnsRecord) error {
+	_, err := c.api.UpdateDNSRecord(c.ctx, c.zone, cloudflare.UpdateDNSRecordParams{
+		ID:      record.ID,
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		Comment: cloudflare.StringPtr(record.Comment),
+		TTL:     record.TTL,
+	})
+	return err
+}
+
+func (c *cloudflareProvider) CreateRecord(record DnsRecord) error {
+	_, err := c.api.CreateDNSRecord(c.ctx, c.zone, cloudflare.CreateDNSRecordParams{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Content,
+		Comment: record.Comment,
+		TTL:     record.TTL,
+	})
+	return err
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"sync"
+)
+
+// maxConcurrentRequests is the maximum number of Terraform Cloud API requests made at the same time by one command
+const maxConcurrentRequests = 4
+
+// mapConcurrently calls fn for each key, with at most maxConcurrentRequests calls running at the same time, and
+// returns a map of keys and results. If any call fails, the error from the first key in the list that failed is
+// returned, so the result does not depend on the order in which the calls finish.
+func mapConcurrently[K comparable, V any](keys []K, fn func(key K) (V, error)) (map[K]V, error) {
+	values := make([]V, len(keys))
+	errs := make([]error, len(keys))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(maxConcurrentRequests, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				values[i], errs[i] = fn(keys[i])
+			}
+		}()
+	}
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	results := make(map[K]V, len(keys))
+	for i, key := range keys {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		results[key] = values[i]
+	}
+	return results, nil
+}
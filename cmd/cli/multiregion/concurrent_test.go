@@ -0,0 +1,54 @@
+package multiregion
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapConcurrently(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var running, maxRunning atomic.Int32
+	got, err := mapConcurrently(keys, func(key string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		return key + key, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		if got[key] != key+key {
+			t.Errorf("result for %s = %q, want %q", key, got[key], key+key)
+		}
+	}
+	if m := maxRunning.Load(); m > maxConcurrentRequests {
+		t.Errorf("%d calls ran at the same time, want at most %d", m, maxConcurrentRequests)
+	}
+}
+
+func TestMapConcurrentlyError(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+
+	// later keys fail first, but the error for the first key in the list is returned
+	_, err := mapConcurrently(keys, func(key string) (int, error) {
+		if key == "a" || key == "b" {
+			return 0, errors.New("no value")
+		}
+		if key == "c" {
+			time.Sleep(10 * time.Millisecond)
+			return 0, fmt.Errorf("failed %s", key)
+		}
+		return 1, nil
+	})
+	if err == nil || err.Error() != "no value" {
+		t.Errorf("err = %v, want the error for key a", err)
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+)
+
+// confirm asks the operator to confirm an operation by typing "yes". With --yes or --non-interactive, the operation
+// is confirmed without a prompt.
+func confirm(pFlags PersistentFlags, message string) bool {
+	if pFlags.assumeYes {
+		_, _ = fmt.Fprintln(pFlags.progress, message+" Confirmed by --yes.")
+		return true
+	}
+	return simplePrompt(pFlags.progress, message+` Type "yes" to continue.`) == "yes"
+}
+
+// confirmDestructive asks the operator to confirm an operation that is disruptive or hard to reverse by typing the
+// IdP key, so that the operator must check which IdP is affected. With --yes or --non-interactive, the operation is
+// confirmed without a prompt.
+func confirmDestructive(pFlags PersistentFlags, message string) bool {
+	if pFlags.assumeYes {
+		_, _ = fmt.Fprintln(pFlags.progress, message+" Confirmed by --yes.")
+		return true
+	}
+
+	answer := simplePrompt(pFlags.progress, fmt.Sprintf("%s Type the IdP key %q to continue.", message, pFlags.idp))
+	if answer != pFlags.idp {
+		_, _ = fmt.Fprintf(pFlags.progress, "%q does not match the IdP key, nothing was changed\n", answer)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package multiregion
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	pFlags := testFlags()
+
+	tests := map[string]bool{
+		"yes\n":  false,
+		"Test\n": false,
+		"test\n": true,
+	}
+	for input, want := range tests {
+		setStdin(t, input)
+		if got := confirmDestructive(pFlags, "Confirm?"); got != want {
+			t.Errorf("input %q: confirmed = %t, want %t", input, got, want)
+		}
+	}
+}
+
+func TestConfirmAssumeYes(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.assumeYes = true
+
+	// no input is available, so a prompt would not be confirmed
+	setStdin(t, "")
+	if !confirm(pFlags, "Confirm?") || !confirmDestructive(pFlags, "Confirm?") {
+		t.Error("--yes did not confirm")
+	}
+}
+
+func TestRunFailoverAssumeYes(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.assumeYes = true
+	tfc := newTestAppliedIdp(t, pFlags)
+	dns := newFakeDNSProvider(testDnsRecords(pFlags.region))
+
+	setStdin(t, "")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), awsFailoverActive); got != "true" {
+		t.Errorf("%s = %q, want true", awsFailoverActive, got)
+	}
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+	if dns.mutations == 0 {
+		t.Error("DNS records were not changed with --yes")
+	}
+}
@@ -7,18 +7,20 @@ package multiregion
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
 
-	"github.com/cloudflare/cloudflare-go"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
 	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
 type DnsCommand struct {
-	cfClient      *cloudflare.API
-	cfZone        *cloudflare.ResourceContainer
+	dns           DNSProvider
+	progress      io.Writer
 	domainName    string
 	env           string
 	failback      bool
@@ -26,8 +28,56 @@ type DnsCommand struct {
 	region        string
 	region2       string
 	testMode      bool
+
+	// confirmed is true if the operator has already confirmed all DNS changes
+	confirmed bool
+
+	records []DnsRecordResult
+}
+
+// DNSProvider is the set of DNS operations used by the dns command. Records are identified by their fully-qualified
+// name.
+type DNSProvider interface {
+	// FindRecord returns the DNS record with the given name, or nil if no record exists
+	FindRecord(name string) (*DnsRecord, error)
+	UpdateRecord(record DnsRecord) error
+	CreateRecord(record DnsRecord) error
+}
+
+// DnsRecord is a DNS record as stored by a DNSProvider
+type DnsRecord struct {
+	ID      string
+	Type    string
+	Name    string
+	Content string
+	Comment string
+	TTL     int
 }
 
+// DnsRecordResult is the before and after value of one DNS record
+type DnsRecordResult struct {
+	Name   string `json:"name" yaml:"name"`
+	Before string `json:"before" yaml:"before"`
+	After  string `json:"after" yaml:"after"`
+	Status string `json:"status" yaml:"status"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// DNS providers supported by the 'dns-provider' parameter
+const (
+	dnsProviderCloudflare = "cloudflare"
+	dnsProviderRoute53    = "route53"
+)
+
+// DNS record result status values
+const (
+	dnsStatusUpdated   = "updated"
+	dnsStatusCreated   = "created"
+	dnsStatusUnchanged = "unchanged"
+	dnsStatusSkipped   = "skipped"
+	dnsStatusFailed    = "failed"
+)
+
 type DnsValues struct {
 	albInternal string
 	albExternal string
@@ -43,8 +93,8 @@ func InitDnsCmd(parentCmd *cobra.Command) {
 		Use:   "dns",
 		Short: "DNS Failover and Failback",
 		Long:  `Configure DNS CNAME values for primary or secondary region hostnames. Default is failover, use --failback to switch back to the primary region.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			runDnsCommand(failback, includeCommon)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDnsCommand(cmd.Context(), failback, includeCommon)
 		},
 	}
 	parentCmd.AddCommand(cmd)
@@ -57,61 +107,103 @@ func InitDnsCmd(parentCmd *cobra.Command) {
 	)
 }
 
-func runDnsCommand(failback, includeCommon bool) {
-	pFlags := getPersistentFlags()
+func runDnsCommand(ctx context.Context, failback, includeCommon bool) error {
+	pFlags, err := getPersistentFlags()
+	if err != nil {
+		return err
+	}
 
 	if pFlags.readOnlyMode {
-		fmt.Println("-- Read-only mode enabled --")
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
 	}
 
-	d := newDnsCommand(pFlags, failback, includeCommon)
-
-	d.setDnsRecordValues(pFlags.idp)
-}
-
-func newDnsCommand(pFlags PersistentFlags, failback, includeCommon bool) *DnsCommand {
-	d := DnsCommand{
-		testMode:   pFlags.readOnlyMode,
-		domainName: viper.GetString(flags.DomainName),
+	domainName, err := getDomainName()
+	if err != nil {
+		return err
 	}
+	provider, err := newDnsProvider(ctx, pFlags, domainName)
+	if err != nil {
+		return err
+	}
+	d := newDnsCommand(pFlags, provider, domainName, failback, includeCommon)
 
-	if d.domainName == "" {
-		log.Fatalln("Cloudflare Domain Name is not configured. Use 'domain-name' parameter.")
+	// the core workspace is locked to show that a DNS change is in progress
+	lock, err := lockWorkspaces(newTerraformCloud(ctx, pFlags), pFlags, "dns", []string{workspaceName(pFlags, Core)})
+	if err != nil {
+		return err
 	}
+	err = d.setDnsRecordValues(pFlags.idp)
+	lock.unlock()
 
-	cfToken := viper.GetString("cloudflare-token")
-	if cfToken == "" {
-		log.Fatalln("Cloudflare Token is not configured. Use 'cloudflare-token' parameter.")
+	output.Print(d.records)
+	return err
+}
+
+func getDomainName() (string, error) {
+	domainName := viper.GetString(flags.DomainName)
+	if domainName == "" {
+		return "", fmt.Errorf("%w: Domain Name is not configured. Use 'domain-name' parameter.", clierr.ErrConfig)
 	}
+	return domainName, nil
+}
 
-	api, err := cloudflare.NewWithAPIToken(cfToken)
-	if err != nil {
-		log.Fatal("failed to initialize the Cloudflare API:", err)
+// newDnsProvider returns the DNSProvider for the DNS service selected by the 'dns-provider' parameter
+func newDnsProvider(ctx context.Context, pFlags PersistentFlags, domainName string) (DNSProvider, error) {
+	var provider DNSProvider
+	var err error
+
+	switch p := viper.GetString(flags.DnsProvider); p {
+	case dnsProviderCloudflare:
+		cfToken := viper.GetString("cloudflare-token")
+		if cfToken == "" {
+			return nil, fmt.Errorf("%w: Cloudflare Token is not configured. Use 'cloudflare-token' parameter.",
+				clierr.ErrConfig)
+		}
+		provider, err = newCloudflareProvider(ctx, pFlags.progress, cfToken, domainName, pFlags.retry)
+
+	case dnsProviderRoute53:
+		// Route 53 is a global service, but the AWS SDK requires a region
+		cfg, cfgErr := config.LoadDefaultConfig(ctx, config.WithRegion(pFlags.region))
+		if cfgErr != nil {
+			return nil, fmt.Errorf("%w: failed to load the AWS configuration: %w", clierr.ErrConfig, cfgErr)
+		}
+		provider, err = newRoute53Provider(ctx, pFlags.progress, cfg, domainName)
+
+	default:
+		return nil, fmt.Errorf("%w: DNS provider %q is not supported. Use %q or %q.", clierr.ErrConfig, p,
+			dnsProviderCloudflare, dnsProviderRoute53)
 	}
-	d.cfClient = api
 
-	zoneID, err := d.cfClient.ZoneIDByName(d.domainName)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("%w: %w", clierr.ErrAPI, err)
 	}
-	fmt.Printf("Using domain name %s with ID %s\n", d.domainName, zoneID)
-	d.cfZone = cloudflare.ZoneIdentifier(zoneID)
-
-	d.env = pFlags.env
-	d.region = pFlags.region
-	d.region2 = pFlags.secondaryRegion
-
-	d.failback = failback
-	d.includeCommon = includeCommon
+	if pFlags.auditLog != nil {
+		provider = newAuditedDNSProvider(provider, pFlags.auditLog)
+	}
+	return provider, nil
+}
 
-	return &d
+func newDnsCommand(pFlags PersistentFlags, dns DNSProvider, domainName string, failback, includeCommon bool) *DnsCommand {
+	return &DnsCommand{
+		dns:           dns,
+		progress:      pFlags.progress,
+		domainName:    domainName,
+		env:           pFlags.env,
+		failback:      failback,
+		includeCommon: includeCommon,
+		region:        pFlags.region,
+		region2:       pFlags.secondaryRegion,
+		testMode:      pFlags.readOnlyMode,
+		confirmed:     pFlags.assumeYes,
+	}
 }
 
-func (d *DnsCommand) setDnsRecordValues(idpKey string) {
+// setDnsRecordValues sets each DNS record, continuing after a failure. An error is returned if any record failed.
+func (d *DnsCommand) setDnsRecordValues(idpKey string) error {
 	if d.failback {
-		fmt.Println("Setting DNS records to primary region...")
+		_, _ = fmt.Fprintln(d.progress, "Setting DNS records to primary region...")
 	} else {
-		fmt.Println("Setting DNS records to secondary region...")
+		_, _ = fmt.Fprintln(d.progress, "Setting DNS records to secondary region...")
 	}
 
 	region := d.region2
@@ -150,54 +242,97 @@ func (d *DnsCommand) setDnsRecordValues(idpKey string) {
 		dnsRecords = append(dnsRecords, common...)
 	}
 
+	failed := 0
 	for _, record := range dnsRecords {
-		d.setCloudflareCname(record.name, record.value+"."+d.domainName)
+		if d.setCname(record.name, record.value+"."+d.domainName).Status == dnsStatusFailed {
+			failed++
+		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d DNS records failed to update", clierr.ErrPartialFailure, failed,
+			len(dnsRecords))
+	}
+	return nil
 }
 
-func (d *DnsCommand) setCloudflareCname(name, value string) {
-	if value == "" {
-		fmt.Printf("  skipping %s (no value provided)\n", name)
-		return
+// setCname sets one DNS record, printing and recording the result
+func (d *DnsCommand) setCname(name, value string) DnsRecordResult {
+	result := d.setCnameValue(name, value)
+	if result.Error != "" {
+		_, _ = fmt.Fprintln(d.progress, "Error:", result.Error)
 	}
+	d.records = append(d.records, result)
+	return result
+}
 
-	fmt.Printf("  %s.%s --> %s\n", name, d.domainName, value)
+func (d *DnsCommand) setCnameValue(name, value string) DnsRecordResult {
+	fqdn := name + "." + d.domainName
+	result := DnsRecordResult{Name: fqdn, After: value, Status: dnsStatusSkipped}
+
+	if value == "" {
+		_, _ = fmt.Fprintf(d.progress, "  skipping %s (no value provided)\n", name)
+		return result
+	}
 
-	ctx := context.Background()
+	_, _ = fmt.Fprintf(d.progress, "  %s --> %s\n", fqdn, value)
 
-	r, _, err := d.cfClient.ListDNSRecords(ctx, d.cfZone, cloudflare.ListDNSRecordsParams{Name: name + "." + d.domainName})
+	r, err := d.dns.FindRecord(fqdn)
 	if err != nil {
-		fmt.Printf("Error: Cloudflare API call failed to find DNS record %s: %s\n", name, err)
-		return
+		result.Status = dnsStatusFailed
+		result.Error = err.Error()
+		return result
 	}
-	if len(r) != 1 {
-		fmt.Printf("Error: did not find DNS record %q in domain %q\n", name, d.domainName)
-		return
+	if r == nil {
+		return d.createCname(fqdn, value, result)
 	}
+	result.Before = r.Content
 
-	if r[0].Content == value {
-		fmt.Printf("CNAME %s is already set to %s\n", name, value)
-		return
+	if r.Content == value {
+		_, _ = fmt.Fprintf(d.progress, "CNAME %s is already set to %s\n", name, value)
+		result.Status = dnsStatusUnchanged
+		return result
 	}
 
 	if d.testMode {
-		fmt.Println("  read-only mode: skipping API call")
-		return
+		_, _ = fmt.Fprintln(d.progress, "  read-only mode: skipping API call")
+		return result
 	}
 
-	answer := simplePrompt(`Type "yes" to set this DNS record`)
-	if answer != "yes" {
-		return
+	if !d.confirmed && simplePrompt(d.progress, `Type "yes" to set this DNS record`) != "yes" {
+		return result
 	}
 
-	_, err = d.cfClient.UpdateDNSRecord(ctx, d.cfZone, cloudflare.UpdateDNSRecordParams{
-		ID:      r[0].ID,
-		Type:    "CNAME",
-		Name:    name,
-		Content: value,
-		Comment: cloudflare.StringPtr(r[0].Comment),
-	})
-	if err != nil {
-		fmt.Printf("error updating DNS record %s: %s\n", name, err)
+	r.Type = "CNAME"
+	r.Content = value
+	if err = d.dns.UpdateRecord(*r); err != nil {
+		result.Status = dnsStatusFailed
+		result.Error = fmt.Sprintf("failed to update DNS record %s: %s", name, err)
+		return result
+	}
+
+	result.Status = dnsStatusUpdated
+	return result
+}
+
+// createCname creates a CNAME record that does not exist yet
+func (d *DnsCommand) createCname(fqdn, value string, result DnsRecordResult) DnsRecordResult {
+	_, _ = fmt.Fprintf(d.progress, "DNS record %s does not exist\n", fqdn)
+
+	if d.testMode {
+		_, _ = fmt.Fprintln(d.progress, "  read-only mode: skipping API call")
+		return result
+	}
+
+	if !d.confirmed && simplePrompt(d.progress, `Type "yes" to create this DNS record`) != "yes" {
+		return result
 	}
+
+	if err := d.dns.CreateRecord(DnsRecord{Type: "CNAME", Name: fqdn, Content: value}); err != nil {
+		result.Status = dnsStatusFailed
+		result.Error = fmt.Sprintf("failed to create DNS record %s: %s", fqdn, err)
+		return result
+	}
+
+	result.Status = dnsStatusCreated
+	return result
 }
@@ -0,0 +1,54 @@
+package multiregion
+
+import (
+	"fmt"
+)
+
+// fakeDNSProvider is an in-memory DNSProvider
+type fakeDNSProvider struct {
+	records map[string]DnsRecord
+
+	// mutations counts the records created or updated
+	mutations int
+
+	nextID int
+}
+
+// newFakeDNSProvider returns a fake DNSProvider containing CNAME records with the given names (key) and values
+func newFakeDNSProvider(cnames map[string]string) *fakeDNSProvider {
+	f := &fakeDNSProvider{records: map[string]DnsRecord{}}
+	for name, value := range cnames {
+		f.nextID++
+		f.records[name] = DnsRecord{ID: fmt.Sprintf("rec-%d", f.nextID), Type: "CNAME", Name: name, Content: value}
+	}
+	return f
+}
+
+func (f *fakeDNSProvider) FindRecord(name string) (*DnsRecord, error) {
+	r, ok := f.records[name]
+	if !ok {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+func (f *fakeDNSProvider) UpdateRecord(record DnsRecord) error {
+	r, ok := f.records[record.Name]
+	if !ok || r.ID != record.ID {
+		return fmt.Errorf("record %s with ID %s not found", record.Name, record.ID)
+	}
+	f.mutations++
+	f.records[record.Name] = record
+	return nil
+}
+
+func (f *fakeDNSProvider) CreateRecord(record DnsRecord) error {
+	if _, ok := f.records[record.Name]; ok {
+		return fmt.Errorf("record %s already exists", record.Name)
+	}
+	f.mutations++
+	f.nextID++
+	record.ID = fmt.Sprintf("rec-%d", f.nextID)
+	f.records[record.Name] = record
+	return nil
+}
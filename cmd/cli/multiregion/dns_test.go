@@ -0,0 +1,166 @@
+package multiregion
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDomain = "example.org"
+
+// testDnsRecords returns the DNS records of the test IdP and the common services, all pointing to one region
+func testDnsRecords(region string) map[string]string {
+	records := map[string]string{}
+	for _, name := range []string{"test", "test-pw-api", "mfa-api", "twosv-api", "sherlock", "watson"} {
+		records[name+"."+testDomain] = name + "-" + region + "." + testDomain
+	}
+	return records
+}
+
+func TestSetDnsRecordValues(t *testing.T) {
+	const primary, secondary = "us-east-1", "us-west-2"
+
+	tests := []struct {
+		name          string
+		env           string
+		failback      bool
+		includeCommon bool
+		start         string
+		want          map[string]string
+	}{
+		{
+			name:  "failover",
+			env:   envProd,
+			start: primary,
+			want: map[string]string{
+				"test":        secondary,
+				"test-pw-api": secondary,
+				"mfa-api":     primary,
+				"twosv-api":   primary,
+				"sherlock":    primary,
+				"watson":      primary,
+			},
+		},
+		{
+			name:     "failback",
+			env:      envProd,
+			failback: true,
+			start:    secondary,
+			want: map[string]string{
+				"test":        primary,
+				"test-pw-api": primary,
+				"mfa-api":     secondary,
+				"twosv-api":   secondary,
+				"sherlock":    secondary,
+				"watson":      secondary,
+			},
+		},
+		{
+			name:          "include common in prod",
+			env:           envProd,
+			includeCommon: true,
+			start:         primary,
+			want: map[string]string{
+				"test":        secondary,
+				"test-pw-api": secondary,
+				"mfa-api":     secondary,
+				"twosv-api":   secondary,
+				"sherlock":    secondary,
+				"watson":      primary,
+			},
+		},
+		{
+			name:          "include common in stg",
+			env:           "stg",
+			includeCommon: true,
+			start:         primary,
+			want: map[string]string{
+				"test":        secondary,
+				"test-pw-api": secondary,
+				"mfa-api":     secondary,
+				"twosv-api":   secondary,
+				"sherlock":    primary,
+				"watson":      secondary,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pFlags := testFlags()
+			pFlags.env = tt.env
+			dns := newFakeDNSProvider(testDnsRecords(tt.start))
+
+			setStdin(t, strings.Repeat("yes\n", len(tt.want)))
+			d := newDnsCommand(pFlags, dns, testDomain, tt.failback, tt.includeCommon)
+			d.setDnsRecordValues(pFlags.idp)
+
+			for name, region := range tt.want {
+				fqdn := name + "." + testDomain
+				want := name + "-" + region + "." + testDomain
+				if got := dns.records[fqdn].Content; got != want {
+					t.Errorf("%s = %s, want %s", fqdn, got, want)
+				}
+			}
+			for _, r := range d.records {
+				if r.Status != dnsStatusUpdated {
+					t.Errorf("%s status = %s, want %s", r.Name, r.Status, dnsStatusUpdated)
+				}
+			}
+		})
+	}
+}
+
+func TestSetDnsRecordValuesAlreadySet(t *testing.T) {
+	pFlags := testFlags()
+	dns := newFakeDNSProvider(testDnsRecords(pFlags.secondaryRegion))
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, true)
+	d.setDnsRecordValues(pFlags.idp)
+
+	if dns.mutations != 0 {
+		t.Errorf("expected no changes, got %d", dns.mutations)
+	}
+	for _, r := range d.records {
+		if r.Status != dnsStatusUnchanged {
+			t.Errorf("%s status = %s, want %s", r.Name, r.Status, dnsStatusUnchanged)
+		}
+	}
+}
+
+func TestSetDnsRecordValuesReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.readOnlyMode = true
+	dns := newFakeDNSProvider(map[string]string{"test." + testDomain: "test-us-east-1." + testDomain})
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+
+	if dns.mutations != 0 {
+		t.Errorf("read-only mode made %d changes", dns.mutations)
+	}
+	if len(d.records) != 2 || d.records[0].Status != dnsStatusSkipped || d.records[1].Status != dnsStatusSkipped {
+		t.Errorf("expected 2 skipped records, got %+v", d.records)
+	}
+}
+
+func TestSetDnsRecordValuesCreate(t *testing.T) {
+	pFlags := testFlags()
+	dns := newFakeDNSProvider(map[string]string{"test." + testDomain: "test-us-east-1." + testDomain})
+
+	setStdin(t, "yes\nno\n")
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+
+	pwAPI := "test-pw-api." + testDomain
+	if got := dns.records[pwAPI].Content; got != "test-pw-api-us-west-2."+testDomain {
+		t.Errorf("%s was not created, got %q", pwAPI, got)
+	}
+	if d.records[0].Status != dnsStatusCreated {
+		t.Errorf("%s status = %s, want %s", pwAPI, d.records[0].Status, dnsStatusCreated)
+	}
+
+	// the second record was not confirmed
+	if d.records[1].Status != dnsStatusSkipped {
+		t.Errorf("%s status = %s, want %s", d.records[1].Name, d.records[1].Status, dnsStatusSkipped)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+func InitFailbackCmd(parentCmd *cobra.Command) {
+	var timeout time.Duration
+
+	failbackCmd := &cobra.Command{
+		Use:   "failback",
+		Short: "Failback to primary region",
+		Long: `Make Terraform changes to return from failover mode to the primary region. The core and secondary
+Terraform workspaces are locked until the first run is started, and the core workspace until the command finishes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runFailback(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), pFlags, timeout)
+		},
+	}
+
+	parentCmd.AddCommand(failbackCmd)
+
+	failbackCmd.PersistentFlags().DurationVar(&timeout, "timeout", defaultRunTimeout,
+		`maximum time to wait for Terraform runs to finish, use 0 to skip waiting`,
+	)
+}
+
+func runFailback(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags, timeout time.Duration) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
+	}
+
+	if !confirmDestructive(pFlags, "Please confirm deactivation of failover mode.") {
+		return clierr.ErrAborted
+	}
+
+	f, err := newFailover(ctx, tfc, pFlags)
+	if err != nil {
+		return err
+	}
+	if err = f.lockWorkspaces(pFlags, "failback"); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+	return f.activate("false", timeout)
+}
@@ -5,11 +5,18 @@ Copyright © 2023 SIL International
 package multiregion
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"slices"
+	"time"
 
 	"github.com/silinternational/tfc-ops/v3/lib"
 	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
 const (
@@ -37,11 +44,33 @@ const (
 
 const awsFailoverActive = "aws_failover_active"
 
+const defaultRunTimeout = time.Hour
+
+// runPollInterval is the time between status checks while waiting for a run to finish
+var runPollInterval = 10 * time.Second
+
+// waitToPoll waits for the run poll interval. An error is returned if the context is canceled first, e.g. by Ctrl-C.
+func waitToPoll(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: interrupted while waiting for Terraform runs: %w", clierr.ErrAborted, ctx.Err())
+	case <-time.After(runPollInterval):
+		return nil
+	}
+}
+
 type Failover struct {
+	ctx      context.Context
+	tfc      TerraformCloud
+	progress io.Writer
 	testMode bool
-	tfcOrg   string
 
 	workspaces map[string]Workspace
+
+	runTriggers []runTrigger
+
+	// lock holds the workspace locks of the operation, or is nil if no workspaces are locked
+	lock *workspaceLock
 }
 
 type Workspace struct {
@@ -49,95 +78,258 @@ type Workspace struct {
 	variables []lib.Var
 }
 
+// FailoverResult is the result of a failover or failback command
+type FailoverResult struct {
+	Workspace     string      `json:"workspace" yaml:"workspace"`
+	Variable      string      `json:"variable" yaml:"variable"`
+	PreviousValue string      `json:"previous_value" yaml:"previous_value"`
+	Value         string      `json:"value" yaml:"value"`
+	Runs          []RunResult `json:"runs" yaml:"runs"`
+
+	// Steps and DnsRecords are only included in the result of a full failover
+	Steps      []RunbookStep     `json:"steps,omitempty" yaml:"steps,omitempty"`
+	DnsRecords []DnsRecordResult `json:"dns_records,omitempty" yaml:"dns_records,omitempty"`
+}
+
+// RunResult is the final state of a run started, directly or by a run trigger, by a failover or failback
+type RunResult struct {
+	Workspace string `json:"workspace" yaml:"workspace"`
+	RunID     string `json:"run_id" yaml:"run_id"`
+	Status    string `json:"status" yaml:"status"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type failoverOptions struct {
+	timeout       time.Duration
+	full          bool
+	includeCommon bool
+	force         bool
+}
+
 func InitFailoverCmd(parentCmd *cobra.Command) {
+	var opts failoverOptions
+
 	failoverCmd := &cobra.Command{
 		Use:   "failover",
 		Short: "Failover to secondary region",
-		Long:  `Make Terraform, AWS, and Cloudflare changes for failover to secondary region`,
-		Run: func(cmd *cobra.Command, args []string) {
-			runFailover()
+		Long: `Make Terraform, AWS, and Cloudflare changes for failover to secondary region. Use --full to also wait
+for the Terraform runs to apply and then switch DNS records to the secondary region, after a single confirmation.
+Failover is confirmed by typing the IdP key, or without a prompt by using --yes.
+
+Before any change is made, pre-flight checks confirm that the secondary region was created: aws_create_secondary is
+true in the core workspace, every secondary workspace exists and is not locked, has no run in progress, and its latest
+run was applied, and the secondary database workspace has state outputs. Failover is refused if any check fails,
+unless --force is used.
+
+The core and secondary Terraform workspaces are locked while failover mode is activated. The secondary workspaces are
+unlocked when the first run is started, and the core workspace when the command finishes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+
+			var d *DnsCommand
+			if opts.full {
+				domainName, err := getDomainName()
+				if err != nil {
+					return err
+				}
+				provider, err := newDnsProvider(cmd.Context(), pFlags, domainName)
+				if err != nil {
+					return err
+				}
+				d = newDnsCommand(pFlags, provider, domainName, false, opts.includeCommon)
+			}
+
+			return runFailover(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), d, pFlags, opts)
 		},
 	}
 
 	parentCmd.AddCommand(failoverCmd)
-}
 
-func runFailover() {
-	pFlags := getPersistentFlags()
+	failoverCmd.PersistentFlags().DurationVar(&opts.timeout, "timeout", defaultRunTimeout,
+		`maximum time to wait for Terraform runs to finish, use 0 to skip waiting`,
+	)
+	failoverCmd.PersistentFlags().BoolVar(&opts.full, "full", false,
+		`run the full failover runbook: set the failover variable, wait for Terraform runs, then switch DNS`,
+	)
+	failoverCmd.PersistentFlags().BoolVar(&opts.includeCommon, "include-common", false,
+		`with --full, also switch DNS records for services used by every IdP`,
+	)
+	failoverCmd.PersistentFlags().BoolVar(&opts.force, "force", false,
+		`continue with failover even if a pre-flight check fails`,
+	)
+}
 
+// runFailover activates failover mode. If the DnsCommand is not nil, the full failover runbook is run.
+func runFailover(ctx context.Context, tfc TerraformCloud, d *DnsCommand, pFlags PersistentFlags, opts failoverOptions) error {
 	if pFlags.readOnlyMode {
-		fmt.Println("-- Read-only mode enabled --")
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
 	}
 
-	lib.SetToken(pFlags.tfcToken)
+	if d != nil && opts.timeout == 0 {
+		return fmt.Errorf("%w: --full requires waiting for Terraform runs, the timeout cannot be 0", clierr.ErrConfig)
+	}
 
-	answer := simplePrompt(`Please confirm activation of failover mode. Type "yes" to continue.`)
-	if answer != "yes" {
-		return
+	if err := checkPreflight(tfc, pFlags, opts.force); err != nil {
+		return err
 	}
 
-	f := newFailover(pFlags)
+	if d == nil {
+		if !confirmDestructive(pFlags, "Please confirm activation of failover mode.") {
+			return clierr.ErrAborted
+		}
+
+		f, err := newFailover(ctx, tfc, pFlags)
+		if err != nil {
+			return err
+		}
+		if err = f.lockWorkspaces(pFlags, "failover"); err != nil {
+			return err
+		}
+		defer f.lock.unlock()
+		return f.activate("true", opts.timeout)
+	}
 
-	f.setFailoverActiveVariable("true")
-	f.createRun(ClusterSecondary, "set "+awsFailoverActive+" to true")
+	_, _ = fmt.Fprintf(pFlags.progress, "Full failover will set %s to true, wait up to %s for Terraform runs to "+
+		"apply, then switch DNS records to %s.\n", awsFailoverActive, opts.timeout, pFlags.secondaryRegion)
+	if !confirmDestructive(pFlags, "Please confirm full failover.") {
+		return clierr.ErrAborted
+	}
+	d.confirmed = true
+
+	f, err := newFailover(ctx, tfc, pFlags)
+	if err != nil {
+		return err
+	}
+	if err = f.lockWorkspaces(pFlags, "failover"); err != nil {
+		return err
+	}
+	defer f.lock.unlock()
+	result, err := f.runbook(d, pFlags.idp, opts.timeout)
+	output.Print(result)
+	return err
 }
 
-func newFailover(pFlags PersistentFlags) *Failover {
-	allWorkspaces := map[string]func(flags PersistentFlags) string{
-		ClusterSecondary:       clusterSecondaryWorkspace,
-		DatabaseSecondary:      databaseSecondaryWorkspace,
-		PhpmyadminSecondary:    pmaSecondaryWorkspace,
-		EmailServiceSecondary:  emailSecondaryWorkspace,
-		IdBrokerSecondary:      brokerSecondaryWorkspace,
-		PwManagerSecondary:     pwSecondaryWorkspace,
-		SimplesamlphpSecondary: sspSecondaryWorkspace,
-		IdSyncSecondary:        syncSecondaryWorkspace,
+// checkPreflight runs the pre-flight checks and lists the failed checks. An error is returned if any check failed and
+// force is false.
+func checkPreflight(tfc TerraformCloud, pFlags PersistentFlags, force bool) error {
+	failed, err := runPreflight(tfc, pFlags)
+	if err != nil {
+		return err
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(pFlags.progress, "\nFailed pre-flight checks:")
+	for _, c := range failed {
+		if c.Detail == "" {
+			_, _ = fmt.Fprintf(pFlags.progress, "  %s - %s\n", c.Workspace, c.Check)
+		} else {
+			_, _ = fmt.Fprintf(pFlags.progress, "  %s - %s (%s)\n", c.Workspace, c.Check, c.Detail)
+		}
 	}
 
+	if force {
+		_, _ = fmt.Fprintln(pFlags.progress, "\nWARNING: continuing with failover because --force was used")
+		return nil
+	}
+	output.Print(failed)
+	return fmt.Errorf("%w: %d pre-flight checks failed, use --force to fail over anyway", clierr.ErrAborted, len(failed))
+}
+
+func newFailover(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags) (*Failover, error) {
 	f := Failover{
-		testMode:   pFlags.readOnlyMode,
-		tfcOrg:     pFlags.org,
-		workspaces: map[string]Workspace{},
+		ctx:         ctx,
+		tfc:         tfc,
+		progress:    pFlags.progress,
+		testMode:    pFlags.readOnlyMode,
+		runTriggers: getRunTriggers(pFlags),
 	}
 
-	fmt.Println("Reading Terraform workspace information...")
-	for wsKey, wsNameFunc := range allWorkspaces {
-		workspaceName := wsNameFunc(pFlags)
-		properties, err := lib.GetWorkspaceData(f.tfcOrg, workspaceName)
+	_, _ = fmt.Fprintln(pFlags.progress, "Reading Terraform workspace information...")
+	workspaces := secondaryWorkspaces(pFlags)
+	var err error
+	f.workspaces, err = mapConcurrently(sortedKeys(workspaces), func(wsKey string) (Workspace, error) {
+		workspaceName := workspaces[wsKey]
+		properties, err := tfc.GetWorkspace(workspaceName)
 		if err != nil {
-			log.Fatalf("failed to get workspace %q: %s", workspaceName, err)
+			return Workspace{}, err
 		}
 
-		variables, err := lib.GetVarsFromWorkspace(f.tfcOrg, workspaceName)
+		variables, err := tfc.ListVariables(workspaceName)
 		if err != nil {
-			log.Fatalf("failed to get workspace %q variables: %s", workspaceName, err)
+			return Workspace{}, fmt.Errorf("failed to get workspace %q variables: %w", workspaceName, err)
 		}
 
-		f.workspaces[wsKey] = Workspace{
-			Workspace: properties.Data,
+		return Workspace{
+			Workspace: properties,
 			variables: variables,
-		}
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// lockWorkspaces locks the core workspace for the whole operation, and the secondary workspaces until the first run is
+// started
+func (f *Failover) lockWorkspaces(pFlags PersistentFlags, operation string) error {
+	var err error
+	f.lock, err = lockWorkspaces(f.tfc, pFlags, operation,
+		append([]string{workspaceName(pFlags, Core)}, secondaryWorkspaceOrder(pFlags)...))
+	return err
+}
+
+// activate sets the failover variable, starts a run, and waits for the resulting runs to finish. The result is
+// written in the selected output format.
+func (f *Failover) activate(value string, timeout time.Duration) error {
+	result := FailoverResult{
+		Workspace: f.workspaces[ClusterSecondary].Attributes.Name,
+		Variable:  awsFailoverActive,
+		Value:     value,
 	}
 
-	return &f
+	var err error
+	result.PreviousValue, err = f.setFailoverActiveVariable(value)
+	if err != nil {
+		return err
+	}
+	run, err := f.createRun(ClusterSecondary, "set "+awsFailoverActive+" to "+value)
+	if err != nil {
+		return err
+	}
+
+	result.Runs, err = f.waitForRuns(ClusterSecondary, run, timeout)
+	output.Print(result)
+	return err
 }
 
-func (f *Failover) setFailoverActiveVariable(value string) {
-	f.setVariable(ClusterSecondary, awsFailoverActive, value)
+func (f *Failover) setFailoverActiveVariable(value string) (string, error) {
+	return f.setVariable(ClusterSecondary, awsFailoverActive, value)
 }
 
-func (f *Failover) setVariable(workspaceKey, variableKey, value string) {
-	fmt.Printf("Setting workspace %s variable %q to true.\n", workspaceKey, variableKey)
+// setVariable sets a variable value and returns the previous value
+func (f *Failover) setVariable(workspaceKey, variableKey, value string) (string, error) {
+	_, _ = fmt.Fprintf(f.progress, "Setting workspace %s variable %q to %s.\n", workspaceKey, variableKey, value)
 	v := f.findVariable(workspaceKey, variableKey)
 
 	if f.testMode {
-		return
+		return v.Value, nil
 	}
 
-	lib.UpdateVariable(f.tfcOrg, f.workspaces[workspaceKey].Attributes.Name, v.ID, lib.TFVar{
+	err := f.tfc.UpdateVariable(f.workspaces[workspaceKey].Attributes.Name, v.ID, lib.TFVar{
 		Key:   variableKey,
 		Value: value,
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to set %s variable %q: %w", workspaceKey, variableKey, err)
+	}
+	return v.Value, nil
 }
 
 func (f *Failover) findVariable(workspace, key string) lib.Var {
@@ -149,25 +341,181 @@ func (f *Failover) findVariable(workspace, key string) lib.Var {
 	return lib.Var{}
 }
 
-func (f *Failover) createRun(workspaceKey, message string) {
+// createRun starts a run on a workspace. The secondary workspaces are unlocked first, because Terraform Cloud does not
+// start runs on a locked workspace, including runs started by run triggers.
+func (f *Failover) createRun(workspaceKey, message string) (Run, error) {
 	workspace := f.workspaces[workspaceKey]
-	fmt.Printf("Starting run on %s, message: %q\n", workspace.Attributes.Name, message)
+	_, _ = fmt.Fprintf(f.progress, "Starting run on %s, message: %q\n", workspace.Attributes.Name, message)
 
 	if f.testMode {
-		return
+		return Run{}, nil
 	}
 
-	err := lib.CreateRun(lib.RunConfig{
-		Message:     message,
-		WorkspaceID: workspace.ID,
-	})
+	for _, key := range sortedKeys(f.workspaces) {
+		f.lock.unlock(f.workspaces[key].Attributes.Name)
+	}
+
+	run, err := f.tfc.CreateRun(workspace.ID, message)
 	if err != nil {
-		log.Fatalf("failed to create a new run on workspace %s: %s", workspace.Attributes.Name, err)
+		return Run{}, fmt.Errorf("failed to create a new run on workspace %s: %w", workspace.Attributes.Name, err)
+	}
+	return run, nil
+}
+
+// waitForRuns waits for a run and all downstream runs started by run triggers to finish. Each run result is printed
+// as it finishes. An error is returned if any run fails or if the timeout expires.
+func (f *Failover) waitForRuns(workspaceKey string, run Run, timeout time.Duration) ([]RunResult, error) {
+	if f.testMode || timeout == 0 {
+		return nil, nil
+	}
+
+	_, _ = fmt.Fprintf(f.progress, "\nWaiting up to %s for Terraform runs to finish...\n", timeout)
+	deadline := time.Now().Add(timeout)
+
+	type pendingRun struct {
+		workspace string
+		run       Run
+		after     time.Time
+	}
+	queue := []pendingRun{{workspace: f.workspaces[workspaceKey].Attributes.Name, run: run}}
+
+	// a workspace with more than one trigger source is only waited on once
+	queued := map[string]bool{queue[0].workspace: true}
+
+	var results []RunResult
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		var err error
+		r := p.run
+		if r.ID == "" {
+			r, err = f.findTriggeredRun(p.workspace, p.after, deadline)
+		}
+		if err == nil {
+			r, err = waitForRun(f.ctx, f.progress, f.tfc, p.workspace, r, deadline)
+		}
+
+		result := RunResult{Workspace: p.workspace, RunID: r.ID, Status: r.Status}
+		if err != nil {
+			result.Error = err.Error()
+		} else if !r.isSuccessful() {
+			result.Error = "run is " + r.Status
+		}
+		results = append(results, result)
+		if errors.Is(err, clierr.ErrAborted) {
+			return results, err
+		}
+
+		// downstream runs are only triggered by a successful apply
+		if err != nil || r.Status != runStatusApplied {
+			continue
+		}
+		for _, downstream := range f.downstreamWorkspaces(p.workspace) {
+			if queued[downstream] {
+				continue
+			}
+			queued[downstream] = true
+			queue = append(queue, pendingRun{workspace: downstream, after: r.appliedAt()})
+		}
+	}
+
+	return results, printRunResults(f.progress, results)
+}
+
+// waitForRun polls a run until it finishes, printing each change in run status
+func waitForRun(ctx context.Context, w io.Writer, tfc TerraformCloud, workspaceName string, run Run, deadline time.Time) (Run, error) {
+	status := ""
+	for {
+		if run.Status != status {
+			status = run.Status
+			_, _ = fmt.Fprintf(w, "  %s: %s\n", workspaceName, status)
+		}
+		if run.isFinished() {
+			return run, nil
+		}
+		if time.Now().After(deadline) {
+			return run, fmt.Errorf("timed out waiting for run %s", run.ID)
+		}
+
+		if err := waitToPoll(ctx); err != nil {
+			return run, err
+		}
+
+		var err error
+		if run, err = tfc.GetRun(run.ID); err != nil {
+			return run, err
+		}
+	}
+}
+
+// findTriggeredRun waits for a run started by a run trigger at or after the given time, when the upstream run was
+// applied, to appear on a workspace. Other runs on the workspace, such as runs started manually, are ignored.
+func (f *Failover) findTriggeredRun(workspaceName string, after, deadline time.Time) (Run, error) {
+	workspaceID, err := getWorkspaceID(f.tfc, workspaceName)
+	if err != nil {
+		return Run{}, err
+	}
+
+	for {
+		runs, err := f.tfc.ListRuns(workspaceID)
+		if err != nil {
+			return Run{}, err
+		}
+		// runs are listed most recent first, so the earliest matching run is the one started by the trigger
+		var found *Run
+		for i := range runs {
+			if runs[i].isTriggeredAfter(after) {
+				found = &runs[i]
+			}
+		}
+		if found != nil {
+			return *found, nil
+		}
+		if time.Now().After(deadline) {
+			return Run{}, fmt.Errorf("timed out waiting for a run to be triggered")
+		}
+		if err = waitToPoll(f.ctx); err != nil {
+			return Run{}, err
+		}
+	}
+}
+
+// downstreamWorkspaces returns the names of the workspaces with a run trigger sourced by the given workspace
+func (f *Failover) downstreamWorkspaces(workspaceName string) []string {
+	var downstream []string
+	for _, trigger := range f.runTriggers {
+		if trigger.source == workspaceName {
+			downstream = append(downstream, trigger.workspace)
+		}
+	}
+	slices.Sort(downstream)
+	return downstream
+}
+
+// printRunResults prints a summary of the run results, and returns an error if any run was not successful
+func printRunResults(w io.Writer, results []RunResult) error {
+	_, _ = fmt.Fprintln(w, "\nTerraform run results:")
+
+	failures := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failures++
+			_, _ = fmt.Fprintf(w, "  %s: FAILED %s\n", r.Workspace, r.Error)
+		} else {
+			_, _ = fmt.Fprintf(w, "  %s: run %s is %s\n", r.Workspace, r.RunID, r.Status)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%w: %d of %d Terraform runs did not complete successfully", clierr.ErrPartialFailure,
+			failures, len(results))
 	}
+	return nil
 }
 
-func simplePrompt(message string) string {
-	fmt.Println(message)
+func simplePrompt(w io.Writer, message string) string {
+	_, _ = fmt.Fprintln(w, message)
 	var prompt string
 	_, _ = fmt.Scanln(&prompt)
 	return prompt
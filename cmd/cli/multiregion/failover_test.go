@@ -0,0 +1,267 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+func init() {
+	runPollInterval = 0
+}
+
+func TestRunFailover(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+
+	setStdin(t, "test\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), awsFailoverActive); got != "true" {
+		t.Errorf("%s = %q, want true", awsFailoverActive, got)
+	}
+
+	// every secondary workspace except phpmyadmin is reached by a chain of run triggers from the cluster
+	for key, workspace := range secondaryWorkspaces(pFlags) {
+		runs := tfc.workspaceRuns(workspace)
+		if key == PhpmyadminSecondary {
+			if len(runs) != 1 {
+				t.Errorf("%s: expected no new runs, got %d", workspace, len(runs)-1)
+			}
+			continue
+		}
+		if len(runs) != 2 || runs[1].Status != runStatusApplied {
+			t.Errorf("%s: expected one new applied run, got %+v", workspace, runs)
+		}
+	}
+}
+
+func TestRunFailoverNotConfirmed(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	mutations := tfc.mutations
+
+	setStdin(t, "no\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); !errors.Is(err, clierr.ErrAborted) {
+		t.Errorf("expected an aborted error, got %v", err)
+	}
+
+	if tfc.mutations != mutations {
+		t.Error("failover made changes without confirmation")
+	}
+	if runs := tfc.workspaceRuns(workspaceName(pFlags, ClusterSecondary)); len(runs) != 1 {
+		t.Errorf("failover started %d runs without confirmation", len(runs)-1)
+	}
+}
+
+func TestRunFailback(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+
+	setStdin(t, "test\ntest\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runFailback(context.Background(), tfc, pFlags, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), awsFailoverActive); got != "false" {
+		t.Errorf("%s = %q, want false", awsFailoverActive, got)
+	}
+	if runs := tfc.workspaceRuns(workspaceName(pFlags, ClusterSecondary)); len(runs) != 3 {
+		t.Errorf("expected 2 new runs on the cluster workspace, got %d", len(runs)-1)
+	}
+}
+
+func TestWaitForRunsFailure(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	tfc.failRuns[workspaceName(pFlags, EmailServiceSecondary)] = true
+
+	f, err := newFailover(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.setFailoverActiveVariable("true"); err != nil {
+		t.Fatal(err)
+	}
+	run, err := f.createRun(ClusterSecondary, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := f.waitForRuns(ClusterSecondary, run, time.Minute)
+	if !errors.Is(err, clierr.ErrPartialFailure) {
+		t.Fatalf("expected a partial failure from the failed run, got %v", err)
+	}
+
+	want := []string{
+		workspaceName(pFlags, ClusterSecondary),
+		workspaceName(pFlags, DatabaseSecondary),
+		workspaceName(pFlags, EmailServiceSecondary),
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d run results, got %+v", len(want), results)
+	}
+	for i, r := range results {
+		if r.Workspace != want[i] {
+			t.Errorf("result %d workspace = %s, want %s", i, r.Workspace, want[i])
+		}
+	}
+	if results[2].Status != runStatusErrored || results[2].Error == "" {
+		t.Errorf("expected an errored run on %s, got %+v", want[2], results[2])
+	}
+}
+
+func TestWaitForRunsMultipleTriggerSources(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+
+	f, err := newFailover(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the email service is triggered by both the cluster and the database
+	cluster := workspaceName(pFlags, ClusterSecondary)
+	email := workspaceName(pFlags, EmailServiceSecondary)
+	if err = tfc.CreateRunTrigger(f.workspaces[EmailServiceSecondary].ID, f.workspaces[ClusterSecondary].ID); err != nil {
+		t.Fatal(err)
+	}
+	f.runTriggers = append(f.runTriggers, runTrigger{workspace: email, source: cluster})
+
+	run, err := f.createRun(ClusterSecondary, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := f.waitForRuns(ClusterSecondary, run, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, r := range results {
+		if seen[r.Workspace] {
+			t.Errorf("run on %s was reported more than once", r.Workspace)
+		}
+		seen[r.Workspace] = true
+	}
+	if !seen[email] {
+		t.Errorf("expected a run result for %s, got %+v", email, results)
+	}
+}
+
+func TestFindTriggeredRun(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	f, err := newFailover(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := workspaceName(pFlags, DatabaseSecondary)
+	id := tfc.workspaces[database].workspace.ID
+
+	// a triggered run from an earlier apply, a manual run, the triggered run, and a later manual run
+	var runs []Run
+	for _, source := range []string{runSourceRunTrigger, "tfe-ui", runSourceRunTrigger, "tfe-api"} {
+		r, err := tfc.CreateRun(id, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tfc.runs[r.ID].Source = source
+		runs = append(runs, r)
+	}
+
+	got, err := f.findTriggeredRun(database, runs[1].CreatedAt, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != runs[2].ID {
+		t.Errorf("found run %s, want the triggered run %s", got.ID, runs[2].ID)
+	}
+}
+
+func TestWaitForRunInterrupted(t *testing.T) {
+	runPollInterval = time.Hour
+	t.Cleanup(func() { runPollInterval = 0 })
+
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	run, err := tfc.CreateRun(tfc.workspaces[workspaceName(pFlags, ClusterSecondary)].workspace.ID, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = waitForRun(ctx, os.Stdout, tfc, "test", run, time.Now().Add(time.Hour))
+	if !errors.Is(err, clierr.ErrAborted) {
+		t.Errorf("err = %v, want ErrAborted", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("waiting for the run was not interrupted")
+	}
+}
+
+func TestRunFailoverFull(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	dns := newFakeDNSProvider(testDnsRecords(pFlags.region))
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+
+	// only one confirmation is needed
+	setStdin(t, "test\n")
+	if err := runFailover(context.Background(), tfc, d, pFlags, failoverOptions{timeout: time.Minute, full: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), awsFailoverActive); got != "true" {
+		t.Errorf("%s = %q, want true", awsFailoverActive, got)
+	}
+	for _, name := range []string{"test", "test-pw-api"} {
+		fqdn := name + "." + testDomain
+		if got, want := dns.records[fqdn].Content, name+"-"+pFlags.secondaryRegion+"."+testDomain; got != want {
+			t.Errorf("%s = %s, want %s", fqdn, got, want)
+		}
+	}
+}
+
+func TestRunbookRunFailure(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	tfc.failRuns[workspaceName(pFlags, DatabaseSecondary)] = true
+	dns := newFakeDNSProvider(testDnsRecords(pFlags.region))
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.confirmed = true
+
+	f, err := newFailover(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := f.runbook(d, pFlags.idp, time.Minute)
+	if err == nil {
+		t.Fatal("expected an error from the failed run")
+	}
+
+	if dns.mutations != 0 {
+		t.Errorf("DNS was changed after a failed run")
+	}
+	wantStatus := []string{stepStatusDone, stepStatusFailed, stepStatusSkipped}
+	if len(result.Steps) != len(wantStatus) {
+		t.Fatalf("expected %d steps, got %+v", len(wantStatus), result.Steps)
+	}
+	for i, s := range result.Steps {
+		if s.Status != wantStatus[i] {
+			t.Errorf("step %d (%s) status = %s, want %s", i+1, s.Name, s.Status, wantStatus[i])
+		}
+	}
+}
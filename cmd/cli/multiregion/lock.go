@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// workspaceLock is the set of Terraform Cloud workspaces locked by one operation, so that other users cannot start
+// runs or make changes with idp-cli while the operation is in progress
+type workspaceLock struct {
+	tfc      TerraformCloud
+	progress io.Writer
+	reason   string
+
+	// workspaces lists the names of the locked workspaces, in the order they were locked
+	workspaces []string
+
+	// workspaceIDs is a map of workspace names (key) and IDs (value) of the locked workspaces
+	workspaceIDs map[string]string
+}
+
+// lockWorkspaces locks the existing workspaces in the list, in order. If any workspace cannot be locked, the
+// workspaces already locked are unlocked and an error is returned. In read-only mode, nothing is locked and the
+// returned lock is nil.
+func lockWorkspaces(tfc TerraformCloud, pFlags PersistentFlags, operation string, workspaces []string) (*workspaceLock, error) {
+	if pFlags.readOnlyMode {
+		return nil, nil
+	}
+
+	l := &workspaceLock{
+		tfc:          tfc,
+		progress:     pFlags.progress,
+		reason:       lockReason(operation),
+		workspaceIDs: map[string]string{},
+	}
+
+	existing, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = fmt.Fprintf(pFlags.progress, "\nLocking workspaces: %s\n", l.reason)
+	for _, workspace := range workspaces {
+		id, ok := existing[workspace]
+		if !ok || l.workspaceIDs[workspace] != "" {
+			continue
+		}
+		if err := tfc.LockWorkspace(id, l.reason); err != nil {
+			l.unlock()
+			return nil, fmt.Errorf("%w\nAnother operation may be in progress. If a previous idp-cli command did not "+
+				"finish, use 'idp-cli unlock' to remove its locks.", err)
+		}
+		_, _ = fmt.Fprintf(pFlags.progress, "  locked %s\n", workspace)
+		l.workspaces = append(l.workspaces, workspace)
+		l.workspaceIDs[workspace] = id
+	}
+	return l, nil
+}
+
+// lockReason returns the reason given for a lock, naming the operation and the operator
+func lockReason(operation string) string {
+	return fmt.Sprintf("idp-cli %s by %s", operation, operator())
+}
+
+// unlock unlocks the given workspaces, or all workspaces held by the lock if none are given. A workspace that cannot
+// be unlocked is reported, but is not an error, so that the remaining workspaces are still unlocked.
+func (l *workspaceLock) unlock(workspaces ...string) {
+	if l == nil {
+		return
+	}
+	if len(workspaces) == 0 {
+		workspaces = slices.Clone(l.workspaces)
+	}
+
+	for _, workspace := range workspaces {
+		id, ok := l.workspaceIDs[workspace]
+		if !ok {
+			continue
+		}
+		if err := l.tfc.UnlockWorkspace(id, false); err != nil {
+			_, _ = fmt.Fprintf(l.progress, "WARNING: %s. Use 'idp-cli unlock' to unlock the workspace.\n", err)
+		} else {
+			_, _ = fmt.Fprintf(l.progress, "  unlocked %s\n", workspace)
+		}
+		delete(l.workspaceIDs, workspace)
+		l.workspaces = slices.DeleteFunc(l.workspaces, func(w string) bool { return w == workspace })
+	}
+}
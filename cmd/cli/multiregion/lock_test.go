@@ -0,0 +1,196 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+)
+
+func TestLockWorkspaces(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	core, cluster, database := workspaceName(pFlags, Core), workspaceName(pFlags, ClusterSecondary),
+		workspaceName(pFlags, DatabaseSecondary)
+
+	lock, err := lockWorkspaces(tfc, pFlags, "test", []string{core, cluster, "missing", core})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tfc.lockedWorkspaces(); !slices.Equal(got, []string{core, cluster}) {
+		t.Errorf("locked workspaces = %v, want %v", got, []string{core, cluster})
+	}
+	if reason := tfc.workspaces[core].lockReason; !strings.HasPrefix(reason, "idp-cli test by ") {
+		t.Errorf("lock reason = %q, does not name the operation", reason)
+	}
+
+	// a workspace that is already locked cannot be locked again, and the other locks are released
+	if _, err = lockWorkspaces(tfc, pFlags, "other", []string{database, cluster}); err == nil {
+		t.Error("expected an error locking a locked workspace")
+	}
+	if got := tfc.lockedWorkspaces(); !slices.Equal(got, []string{core, cluster}) {
+		t.Errorf("locked workspaces = %v after a failed lock, want %v", got, []string{core, cluster})
+	}
+
+	lock.unlock(cluster)
+	if got := tfc.lockedWorkspaces(); !slices.Equal(got, []string{core}) {
+		t.Errorf("locked workspaces = %v, want %v", got, []string{core})
+	}
+	lock.unlock()
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked", got)
+	}
+}
+
+func TestLockWorkspacesReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.readOnlyMode = true
+	tfc := newTestIdp(pFlags)
+
+	lock, err := lockWorkspaces(tfc, pFlags, "test", []string{workspaceName(pFlags, Core)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.unlock()
+	if len(tfc.locked) != 0 {
+		t.Errorf("read-only mode locked %v", tfc.locked)
+	}
+}
+
+func TestRunFailoverLocks(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+	tfc.locked = nil
+
+	setStdin(t, "test\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append([]string{workspaceName(pFlags, Core)}, secondaryWorkspaceOrder(pFlags)...)
+	if !slices.Equal(tfc.locked, want) {
+		t.Errorf("locked workspaces = %v, want %v", tfc.locked, want)
+	}
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked after failover", got)
+	}
+}
+
+func TestRunSetupLocks(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestIdp(pFlags)
+
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal:            filepath.Join(t.TempDir(), "journal.json"),
+		secrets:            testSecrets(pFlags),
+		zones:              testZones,
+		setRemoteConsumers: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(tfc.locked, workspaceName(pFlags, Core)) {
+		t.Errorf("core workspace was not locked, locked %v", tfc.locked)
+	}
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked after setup", got)
+	}
+}
+
+func TestLocksReleasedOnFailure(t *testing.T) {
+	pFlags := testFlags()
+
+	// setup fails when cloning the first secondary workspace
+	tfc := newTestIdp(pFlags)
+	tfc.failMethods["CloneWorkspace"] = true
+	err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal: filepath.Join(t.TempDir(), "journal.json"),
+		secrets: testSecrets(pFlags),
+		zones:   testZones,
+	})
+	if !errors.Is(err, clierr.ErrAPI) {
+		t.Errorf("setup err = %v, want ErrAPI", err)
+	}
+	if len(tfc.locked) == 0 {
+		t.Error("setup did not lock any workspaces")
+	}
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked after setup failed", got)
+	}
+
+	// failover fails when setting the failover variable
+	tfc = newTestAppliedIdp(t, pFlags)
+	tfc.locked = nil
+	tfc.failMethods["UpdateVariable"] = true
+	setStdin(t, "test\n")
+	if err = runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err == nil {
+		t.Error("expected failover to fail")
+	}
+	if len(tfc.locked) == 0 {
+		t.Error("failover did not lock any workspaces")
+	}
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked after failover failed", got)
+	}
+}
+
+func TestRunUnlock(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	if _, err := lockWorkspaces(tfc, pFlags, "test", secondaryWorkspaceOrder(pFlags)); err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "yes\n")
+	if err := runUnlock(tfc, pFlags, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := tfc.lockedWorkspaces(); len(got) != 0 {
+		t.Errorf("workspaces %v are still locked", got)
+	}
+}
+
+func TestUnlockParams(t *testing.T) {
+	root := &cobra.Command{Use: "idp-cli"}
+	InitUnlockCmd(root)
+	cmd, _, err := root.Find([]string{"unlock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.ParseFlags([]string{"--env", "stg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.PreRunE(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	params := map[string]any{flags.Env: "prod", flags.Idp: "test", flags.Org: "test-org", flags.TfcToken: "token",
+		flags.ReadOnlyMode: true}
+	for key, value := range params {
+		viper.Set(key, value)
+	}
+	t.Cleanup(func() {
+		for key := range params {
+			viper.Set(key, nil)
+		}
+	})
+
+	// the regions are not needed, and the unlock --env flag does not replace the env parameter of other commands
+	pFlags, err := loadPersistentFlags(unlockParam)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pFlags.env != "stg" || viper.GetString(flags.Env) != "prod" {
+		t.Errorf("env = %q, env parameter = %q, want stg and prod", pFlags.env, viper.GetString(flags.Env))
+	}
+}
@@ -6,12 +6,15 @@ package multiregion
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"slices"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
 	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
 const envProd = "prod"
@@ -24,23 +27,32 @@ func SetupMultiregionCmd(parentCommand *cobra.Command) {
 	}
 
 	parentCommand.AddCommand(multiregionCmd)
+	InitApplyAllCmd(multiregionCmd)
+	InitCatalogCmd(multiregionCmd)
 	InitDnsCmd(multiregionCmd)
+	InitFailbackCmd(multiregionCmd)
 	InitFailoverCmd(multiregionCmd)
+	InitRelocateCmd(multiregionCmd)
 	InitSetupCmd(multiregionCmd)
 	InitStatusCmd(multiregionCmd)
+	InitTeardownCmd(multiregionCmd)
 
 	flags.NewStringFlag(multiregionCmd, flags.DomainName, "", "", "Domain name")
+	flags.NewStringFlag(multiregionCmd, flags.DnsProvider, "", dnsProviderCloudflare, "DNS provider: cloudflare or route53")
 	flags.NewStringFlag(multiregionCmd, flags.Env, "", envProd, "Execution environment")
 	flags.NewStringFlag(multiregionCmd, flags.Region2, "", "", "Secondary AWS region")
 	flags.NewStringFlag(multiregionCmd, flags.TfcToken, "", "", "Token for Terraform Cloud authentication")
+	flags.NewStringFlag(multiregionCmd, flags.WorkspaceNameTemplate, "", defaultWorkspaceNameTemplate,
+		"Terraform workspace name template, with placeholders {idp}, {env}, {number}, and {name}")
 }
 
-func outputFlagError(cmd *cobra.Command, err error) {
+func outputFlagError(cmd *cobra.Command, err error) error {
 	cmd.Help()
-	log.Fatalln("Error: unable to bind flag:", err)
+	return fmt.Errorf("unable to bind flag: %w", err)
 }
 
 type PersistentFlags struct {
+	catalog         *catalog
 	env             string
 	idp             string
 	org             string
@@ -48,115 +60,160 @@ type PersistentFlags struct {
 	region          string
 	secondaryRegion string
 	tfcToken        string
-}
 
-func getPersistentFlags() PersistentFlags {
-	pFlags := PersistentFlags{
-		env:             getRequiredParam(flags.Env),
-		idp:             getRequiredParam(flags.Idp),
-		org:             getRequiredParam(flags.Org),
-		tfcToken:        getRequiredParam(flags.TfcToken),
-		region:          getRequiredParam(flags.Region),
-		secondaryRegion: getRequiredParam(flags.Region2),
-		readOnlyMode:    viper.GetBool(flags.ReadOnlyMode),
-	}
+	// assumeYes is true if confirmation prompts are answered automatically, with --yes or --non-interactive
+	assumeYes bool
 
-	return pFlags
-}
+	// nonInteractive is true if no input may be requested from the operator
+	nonInteractive bool
 
-func getRequiredParam(key string) string {
-	value := viper.GetString(key)
+	// workspaceNameTemplate forms the workspace names from the IdP, environment, and catalog key
+	workspaceNameTemplate string
 
-	if value == "" {
-		log.Fatalf("parameter %[1]s is not set, use --%[1]s on command line or include in idp-cli.toml file", key)
-	}
-	return value
-}
+	// retry controls how failed Terraform Cloud and Cloudflare API requests are retried
+	retry retryPolicy
 
-func getOption(key, defaultValue string) string {
-	value := viper.GetString(key)
-	if value == "" {
-		value = defaultValue
-	}
-	return value
-}
+	// auditLog records each change made to Terraform Cloud and DNS records. It is nil in read-only mode.
+	auditLog *auditLog
 
-func coreWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-000-core", pFlags.idp, pFlags.env)
+	// progress is the destination of progress messages and prompts, kept separate from the command result
+	progress io.Writer
 }
 
-func clusterWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-010-cluster", pFlags.idp, pFlags.env)
+func getPersistentFlags() (PersistentFlags, error) {
+	return loadPersistentFlags(viper.GetString, flags.Region, flags.Region2)
 }
 
-func clusterSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-010-cluster-secondary", pFlags.idp, pFlags.env)
-}
+// loadPersistentFlags reads the parameters with the given function. The environment, IdP, organization, and Terraform
+// Cloud token are always required, as are any other parameters listed.
+func loadPersistentFlags(param func(key string) string, required ...string) (PersistentFlags, error) {
+	c, err := loadCatalog()
+	if err != nil {
+		return PersistentFlags{}, err
+	}
 
-func databaseWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-020-database", pFlags.idp, pFlags.env)
-}
+	pFlags := PersistentFlags{
+		catalog:        c,
+		readOnlyMode:   viper.GetBool(flags.ReadOnlyMode),
+		assumeYes:      viper.GetBool(flags.Yes) || viper.GetBool(flags.NonInteractive),
+		nonInteractive: viper.GetBool(flags.NonInteractive),
+		progress:       output.Progress(),
 
-func databaseSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-020-database-secondary", pFlags.idp, pFlags.env)
-}
+		workspaceNameTemplate: param(flags.WorkspaceNameTemplate),
+	}
+	if pFlags.workspaceNameTemplate == "" {
+		pFlags.workspaceNameTemplate = defaultWorkspaceNameTemplate
+	}
 
-func ecrWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-022-ecr", pFlags.idp, pFlags.env)
-}
+	params := map[string]*string{
+		flags.Env:      &pFlags.env,
+		flags.Idp:      &pFlags.idp,
+		flags.Org:      &pFlags.org,
+		flags.TfcToken: &pFlags.tfcToken,
+		flags.Region:   &pFlags.region,
+		flags.Region2:  &pFlags.secondaryRegion,
+	}
+	required = append([]string{flags.Env, flags.Idp, flags.Org, flags.TfcToken}, required...)
+	for _, key := range sortedKeys(params) {
+		if *params[key] = param(key); *params[key] == "" && slices.Contains(required, key) {
+			return PersistentFlags{}, missingParamError(key)
+		}
+	}
 
-func pmaWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-030-phpmyadmin", pFlags.idp, pFlags.env)
-}
+	if pFlags.retry, err = getRetryPolicy(); err != nil {
+		return PersistentFlags{}, err
+	}
 
-func pmaSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-030-phpmyadmin-secondary", pFlags.idp, pFlags.env)
-}
+	if err = checkWorkspaceNameTemplate(pFlags.workspaceNameTemplate); err != nil {
+		return PersistentFlags{}, fmt.Errorf("%w: %w", clierr.ErrConfig, err)
+	}
+	if err = checkWorkspaceNames(pFlags); err != nil {
+		return PersistentFlags{}, fmt.Errorf("%w: %w", clierr.ErrConfig, err)
+	}
 
-func emailWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-031-email-service", pFlags.idp, pFlags.env)
-}
+	if !pFlags.readOnlyMode {
+		if pFlags.auditLog, err = newAuditLog(pFlags); err != nil {
+			return PersistentFlags{}, err
+		}
+	}
 
-func emailSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-031-email-service-secondary", pFlags.idp, pFlags.env)
+	return pFlags, nil
 }
 
-func backupWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-032-db-backup", pFlags.idp, pFlags.env)
-}
+func getRequiredParam(key string) (string, error) {
+	value := viper.GetString(key)
 
-func brokerWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-040-id-broker", pFlags.idp, pFlags.env)
+	if value == "" {
+		return "", missingParamError(key)
+	}
+	return value, nil
 }
 
-func brokerSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-040-id-broker-secondary", pFlags.idp, pFlags.env)
+func missingParamError(key string) error {
+	return fmt.Errorf("%[1]w: parameter %[2]s is not set, use --%[2]s on command line or include in idp-cli.toml file",
+		clierr.ErrConfig, key)
 }
 
-func searchWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-041-id-broker-search", pFlags.idp, pFlags.env)
+func getOption(key, defaultValue string) string {
+	value := viper.GetString(key)
+	if value == "" {
+		value = defaultValue
+	}
+	return value
 }
 
-func pwWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-050-pw-manager", pFlags.idp, pFlags.env)
-}
+// findIdpWorkspaces returns a map of workspace names (key) and IDs (value) of all existing catalog workspaces for the
+// IdP
+func findIdpWorkspaces(tfc TerraformCloud, pFlags PersistentFlags) (map[string]string, error) {
+	found, err := tfc.FindWorkspaces(workspaceNamePrefix(pFlags))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workspaces: %w", err)
+	}
 
-func pwSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-050-pw-manager-secondary", pFlags.idp, pFlags.env)
+	// the search may also find workspaces of other IdPs, e.g. "idp-my-" also matches "idp-my-other-prod-000-core"
+	workspaces := map[string]string{}
+	for name, id := range found {
+		if _, ok := workspaceKey(pFlags, name); ok {
+			workspaces[name] = id
+		}
+	}
+	return workspaces, nil
 }
 
-func sspWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-060-simplesamlphp", pFlags.idp, pFlags.env)
+// workspaceExists returns true if a workspace with the exact name given exists
+func workspaceExists(tfc TerraformCloud, workspace string) (bool, error) {
+	workspaces, err := tfc.FindWorkspaces(workspace)
+	if err != nil {
+		return false, fmt.Errorf("failed to find workspace %s: %w", workspace, err)
+	}
+	_, ok := workspaces[workspace]
+	return ok, nil
 }
 
-func sspSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-060-simplesamlphp-secondary", pFlags.idp, pFlags.env)
+// getWorkspaceID returns the ID of a workspace
+func getWorkspaceID(tfc TerraformCloud, workspaceName string) (string, error) {
+	id, err := tfc.GetWorkspaceID(workspaceName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace data: %w", err)
+	}
+	return id, nil
 }
 
-func syncWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-070-id-sync", pFlags.idp, pFlags.env)
+// secondaryWorkspaceOrder returns the names of all secondary workspaces in dependency order. Each workspace may
+// depend on any workspace before it in the list.
+func secondaryWorkspaceOrder(pFlags PersistentFlags) []string {
+	var names []string
+	for _, key := range pFlags.catalog.secondaries() {
+		names = append(names, workspaceName(pFlags, key))
+	}
+	return names
 }
 
-func syncSecondaryWorkspace(pFlags PersistentFlags) string {
-	return fmt.Sprintf("idp-%s-%s-070-id-sync-secondary", pFlags.idp, pFlags.env)
+// secondaryWorkspaces returns a map of workspace keys (key) and workspace names (value) of all secondary workspaces
+func secondaryWorkspaces(pFlags PersistentFlags) map[string]string {
+	workspaces := map[string]string{}
+	for _, key := range pFlags.catalog.secondaries() {
+		workspaces[key] = workspaceName(pFlags, key)
+	}
+	return workspaces
 }
@@ -0,0 +1,173 @@
+package multiregion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+)
+
+func testFlags() PersistentFlags {
+	return PersistentFlags{
+		catalog:         defaultCatalog(),
+		env:             "prod",
+		idp:             "test",
+		org:             "test-org",
+		region:          "us-east-1",
+		secondaryRegion: "us-west-2",
+		tfcToken:        "token",
+		progress:        os.Stdout,
+
+		workspaceNameTemplate: defaultWorkspaceNameTemplate,
+	}
+}
+
+// newTestIdp returns a fake Terraform Cloud containing the primary workspaces of an IdP that is not yet configured
+// for multiregion
+func newTestIdp(pFlags PersistentFlags) *fakeTerraformCloud {
+	tfc := newFakeTerraformCloud()
+	addTestIdp(tfc, pFlags)
+	return tfc
+}
+
+// addTestIdp adds the primary workspaces of an IdP to a fake Terraform Cloud
+func addTestIdp(tfc *fakeTerraformCloud, pFlags PersistentFlags) {
+	remote := func(workspace string) string { return pFlags.org + "/" + workspace }
+
+	tfc.addWorkspace(workspaceName(pFlags, Core), "000-core", map[string]string{
+		"aws_region": pFlags.region,
+	})
+	tfc.addWorkspace(workspaceName(pFlags, Cluster), "010-cluster", map[string]string{
+		"aws_failover_active": "false",
+		"aws_region":          pFlags.region,
+	})
+	tfc.addWorkspace(workspaceName(pFlags, Database), "020-database", map[string]string{
+		"backup_retention_period": "14",
+		"multi_az":                "true",
+		"skip_final_snapshot":     "false",
+		"tf_remote_cluster":       remote(workspaceName(pFlags, Cluster)),
+	})
+	tfc.addWorkspace(workspaceName(pFlags, Ecr), "022-ecr", nil)
+	tfc.addWorkspace(workspaceName(pFlags, Phpmyadmin), "030-phpmyadmin", map[string]string{
+		"pma_subdomain":      pFlags.idp + "-pma",
+		"tf_remote_cluster":  remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_database": remote(workspaceName(pFlags, Database)),
+	})
+	tfc.addWorkspace(workspaceName(pFlags, EmailService), "031-email-service", map[string]string{
+		"aws_region":         pFlags.region,
+		"tf_remote_cluster":  remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_database": remote(workspaceName(pFlags, Database)),
+	})
+	tfc.addWorkspace(workspaceName(pFlags, DbBackup), "032-db-backup", nil)
+	broker := tfc.addWorkspace(workspaceName(pFlags, IdBroker), "040-id-broker", map[string]string{
+		"aws_region":         pFlags.region,
+		"tf_remote_cluster":  remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_database": remote(workspaceName(pFlags, Database)),
+		"tf_remote_email":    remote(workspaceName(pFlags, EmailService)),
+	})
+	broker.variables = append(broker.variables, lib.Var{ID: tfc.newID("var"), Key: "db_password", Sensitive: true})
+	tfc.addWorkspace(workspaceName(pFlags, IdBrokerSearch), "041-id-broker-search", nil)
+	tfc.addWorkspace(workspaceName(pFlags, PwManager), "050-pw-manager", map[string]string{
+		"aws_region":         pFlags.region,
+		"tf_remote_broker":   remote(workspaceName(pFlags, IdBroker)),
+		"tf_remote_cluster":  remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_database": remote(workspaceName(pFlags, Database)),
+		"tf_remote_email":    remote(workspaceName(pFlags, EmailService)),
+	})
+	tfc.addWorkspace(workspaceName(pFlags, Simplesamlphp), "060-simplesamlphp", map[string]string{
+		"aws_region":          pFlags.region,
+		"tf_remote_broker":    remote(workspaceName(pFlags, IdBroker)),
+		"tf_remote_cluster":   remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_database":  remote(workspaceName(pFlags, Database)),
+		"tf_remote_pwmanager": remote(workspaceName(pFlags, PwManager)),
+	})
+	tfc.addWorkspace(workspaceName(pFlags, IdSync), "070-id-sync", map[string]string{
+		"aws_region":        pFlags.region,
+		"tf_remote_broker":  remote(workspaceName(pFlags, IdBroker)),
+		"tf_remote_cluster": remote(workspaceName(pFlags, Cluster)),
+		"tf_remote_email":   remote(workspaceName(pFlags, EmailService)),
+	})
+}
+
+// newTestMultiregionIdp returns a fake Terraform Cloud containing an IdP that has been set up for multiregion
+func newTestMultiregionIdp(t *testing.T, pFlags PersistentFlags) *fakeTerraformCloud {
+	t.Helper()
+
+	tfc := newTestIdp(pFlags)
+	err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal:            filepath.Join(t.TempDir(), "journal.json"),
+		secrets:            testSecrets(pFlags),
+		zones:              testZones,
+		setRemoteConsumers: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tfc
+}
+
+// newTestAppliedIdp returns a fake Terraform Cloud with an IdP that has been set up for multiregion, with an applied
+// run on each secondary workspace
+func newTestAppliedIdp(t *testing.T, pFlags PersistentFlags) *fakeTerraformCloud {
+	tfc := newTestMultiregionIdp(t, pFlags)
+	for _, workspace := range secondaryWorkspaceOrder(pFlags) {
+		tfc.addAppliedRun(workspace)
+	}
+	return tfc
+}
+
+// newTestSetup returns a setup that uses testZones
+func newTestSetup(t *testing.T, tfc TerraformCloud, pFlags PersistentFlags) *setup {
+	t.Helper()
+
+	s, err := newSetup(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.zoneFinder = testZones
+	return s
+}
+
+// fakeZoneFinder is a ZoneFinder with a fixed list of zones for each region
+type fakeZoneFinder map[string][]string
+
+func (f fakeZoneFinder) FindZones(ctx context.Context, region string) ([]string, error) {
+	return f[region], nil
+}
+
+var testZones = fakeZoneFinder{
+	"us-east-1": {"us-east-1a", "us-east-1b", "us-east-1c", "us-east-1d", "us-east-1e", "us-east-1f"},
+	"us-east-2": {"us-east-2a", "us-east-2b", "us-east-2c"},
+	"us-west-1": {"us-west-1a", "us-west-1c"},
+	"us-west-2": {"us-west-2a", "us-west-2b", "us-west-2c", "us-west-2d"},
+}
+
+// testSecrets returns a secret source with a value for each sensitive variable of the test IdP
+func testSecrets(pFlags PersistentFlags) fileSecrets {
+	return fileSecrets{values: map[string]map[string]string{
+		workspaceName(pFlags, IdBrokerSecondary): {"db_password": "secondary-db-password"},
+	}}
+}
+
+// setStdin replaces os.Stdin with a pipe containing the given input, such as the answers to prompts
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
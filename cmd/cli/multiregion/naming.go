@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// Placeholders of the workspace name template
+const (
+	namePlaceholderIdp    = "{idp}"
+	namePlaceholderEnv    = "{env}"
+	namePlaceholderNumber = "{number}"
+	namePlaceholderName   = "{name}"
+)
+
+// defaultWorkspaceNameTemplate is the naming convention of the idp-in-a-box workspaces,
+// e.g. "idp-myidp-prod-010-cluster"
+const defaultWorkspaceNameTemplate = "idp-{idp}-{env}-{number}-{name}"
+
+// placeholderPattern matches any placeholder in a workspace name template
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// checkWorkspaceNameTemplate returns an error if a workspace name template has an unknown or repeated placeholder,
+// or does not include the module name
+func checkWorkspaceNameTemplate(template string) error {
+	seen := map[string]bool{}
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		switch p {
+		case namePlaceholderIdp, namePlaceholderEnv, namePlaceholderNumber, namePlaceholderName:
+		default:
+			return fmt.Errorf("unknown placeholder %s in workspace name template %q", p, template)
+		}
+		if seen[p] {
+			return fmt.Errorf("placeholder %s is used more than once in workspace name template %q", p, template)
+		}
+		seen[p] = true
+	}
+	if !seen[namePlaceholderName] {
+		return fmt.Errorf("workspace name template %q must include %s", template, namePlaceholderName)
+	}
+	return nil
+}
+
+// splitKey splits a catalog key into the module number and module name, e.g. "010-cluster-secondary" into "010" and
+// "cluster-secondary". A key without a number prefix is returned as the module name.
+func splitKey(key string) (number, name string) {
+	number, name, found := strings.Cut(key, "-")
+	if !found || number == "" || strings.Trim(number, "0123456789") != "" {
+		return "", key
+	}
+	return number, name
+}
+
+// workspaceName returns the name of the workspace with the given catalog key
+func workspaceName(pFlags PersistentFlags, key string) string {
+	number, name := splitKey(key)
+	return strings.NewReplacer(
+		namePlaceholderIdp, pFlags.idp,
+		namePlaceholderEnv, pFlags.env,
+		namePlaceholderNumber, number,
+		namePlaceholderName, name,
+	).Replace(pFlags.workspaceNameTemplate)
+}
+
+// workspaceNamePrefix returns the part of the workspace names that is the same for every workspace of the IdP
+func workspaceNamePrefix(pFlags PersistentFlags) string {
+	template := pFlags.workspaceNameTemplate
+	for _, p := range placeholderPattern.FindAllStringIndex(template, -1) {
+		placeholder := template[p[0]:p[1]]
+		if placeholder == namePlaceholderNumber || placeholder == namePlaceholderName {
+			template = template[:p[0]]
+			break
+		}
+	}
+	return strings.NewReplacer(namePlaceholderIdp, pFlags.idp, namePlaceholderEnv, pFlags.env).Replace(template)
+}
+
+// parseWorkspaceName returns the module number and module name of a workspace of the IdP. The IdP and environment
+// are matched literally, so they may contain hyphens. If the template does not include the module number, the
+// returned number is empty. The last return value is false if the name does not match the template.
+func parseWorkspaceName(pFlags PersistentFlags, workspace string) (number, name string, ok bool) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	template := pFlags.workspaceNameTemplate
+	last := 0
+	for _, p := range placeholderPattern.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:p[0]]))
+		switch template[p[0]:p[1]] {
+		case namePlaceholderIdp:
+			pattern.WriteString(regexp.QuoteMeta(pFlags.idp))
+		case namePlaceholderEnv:
+			pattern.WriteString(regexp.QuoteMeta(pFlags.env))
+		case namePlaceholderNumber:
+			pattern.WriteString(`(?P<number>[0-9]*)`)
+		case namePlaceholderName:
+			pattern.WriteString(`(?P<name>.+)`)
+		}
+		last = p[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return "", "", false
+	}
+	m := re.FindStringSubmatch(workspace)
+	if m == nil {
+		return "", "", false
+	}
+	if i := re.SubexpIndex("number"); i > 0 {
+		number = m[i]
+	}
+	return number, m[re.SubexpIndex("name")], true
+}
+
+// workspaceKey returns the catalog key of a workspace of the IdP. The last return value is false if the name does not
+// match the template or the workspace is not in the catalog.
+func workspaceKey(pFlags PersistentFlags, workspace string) (string, bool) {
+	number, name, ok := parseWorkspaceName(pFlags, workspace)
+	if !ok {
+		return "", false
+	}
+
+	hasNumber := strings.Contains(pFlags.workspaceNameTemplate, namePlaceholderNumber)
+	for _, w := range pFlags.catalog.workspaces {
+		keyNumber, keyName := splitKey(w.Key)
+		if keyName == name && (!hasNumber || keyNumber == number) {
+			return w.Key, true
+		}
+	}
+	return "", false
+}
+
+// checkWorkspaceNames returns an error if the name of a catalog workspace cannot be parsed back to its key, e.g. if
+// the template does not include the module number and two keys have the same module name
+func checkWorkspaceNames(pFlags PersistentFlags) error {
+	for _, w := range pFlags.catalog.workspaces {
+		name := workspaceName(pFlags, w.Key)
+		if key, ok := workspaceKey(pFlags, name); !ok || key != w.Key {
+			return fmt.Errorf("workspace name %s of %s is ambiguous with workspace name template %q", name, w.Key,
+				pFlags.workspaceNameTemplate)
+		}
+	}
+	return nil
+}
+
+// workingDirectory returns the Terraform working directory for a workspace, which is its catalog key
+func workingDirectory(pFlags PersistentFlags, workspace string) (string, error) {
+	key, ok := workspaceKey(pFlags, workspace)
+	if !ok {
+		return "", fmt.Errorf("%w: workspace %s does not match the workspace name template %q or is not in the catalog",
+			clierr.ErrNotFound, workspace, pFlags.workspaceNameTemplate)
+	}
+	return key, nil
+}
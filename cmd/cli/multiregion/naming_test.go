@@ -0,0 +1,102 @@
+package multiregion
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceName(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.idp = "my-idp"
+
+	tests := map[string]string{
+		defaultWorkspaceNameTemplate: "idp-my-idp-prod-010-cluster-secondary",
+		"{env}-{idp}-{name}":         "prod-my-idp-cluster-secondary",
+		"{name}.{number}@{idp}":      "cluster-secondary.010@my-idp",
+	}
+	for template, want := range tests {
+		pFlags.workspaceNameTemplate = template
+		name := workspaceName(pFlags, ClusterSecondary)
+		if name != want {
+			t.Errorf("%s: name = %s, want %s", template, name, want)
+		}
+		if key, ok := workspaceKey(pFlags, name); !ok || key != ClusterSecondary {
+			t.Errorf("%s: key = %q, %t, want %s", template, key, ok, ClusterSecondary)
+		}
+		if err := checkWorkspaceNames(pFlags); err != nil {
+			t.Errorf("%s: %s", template, err)
+		}
+	}
+}
+
+func TestParseWorkspaceName(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.idp = "my"
+
+	if _, _, ok := parseWorkspaceName(pFlags, "idp-my-other-prod-000-core"); ok {
+		t.Error("a workspace of IdP my-other was parsed as a workspace of IdP my")
+	}
+	number, name, ok := parseWorkspaceName(pFlags, "idp-my-prod-040-id-broker-secondary")
+	if !ok || number != "040" || name != "id-broker-secondary" {
+		t.Errorf("parsed %q, %q, %t, want 040, id-broker-secondary", number, name, ok)
+	}
+}
+
+func TestCheckWorkspaceNameTemplate(t *testing.T) {
+	for _, template := range []string{"idp-{idp}-{env}", "{idp}-{name}-{name}", "{org}-{name}"} {
+		if err := checkWorkspaceNameTemplate(template); err == nil {
+			t.Errorf("%s: expected an error", template)
+		}
+	}
+	if err := checkWorkspaceNameTemplate(defaultWorkspaceNameTemplate); err != nil {
+		t.Errorf("default template: %s", err)
+	}
+}
+
+func TestFindIdpWorkspacesIgnoresOtherEnvs(t *testing.T) {
+	pFlags := testFlags()
+	other := pFlags
+	other.env = "prod-eu"
+
+	tfc := newTestIdp(pFlags)
+	addTestIdp(tfc, other)
+
+	workspaces, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range workspaces {
+		if key, _ := workspaceKey(other, name); key != "" {
+			t.Errorf("found workspace %s of environment prod-eu", name)
+		}
+	}
+}
+
+func TestSetupWithNameTemplate(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.idp = "my-idp"
+	pFlags.workspaceNameTemplate = "{env}-{idp}-{name}"
+	tfc := newTestIdp(pFlags)
+
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal:            filepath.Join(t.TempDir(), "journal.json"),
+		secrets:            testSecrets(pFlags),
+		zones:              testZones,
+		setRemoteConsumers: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := tfc.GetWorkspace("prod-my-idp-cluster-secondary")
+	if err != nil {
+		t.Fatalf("secondary workspace was not created: %s", err)
+	}
+	if w.Attributes.WorkingDirectory != ClusterSecondary {
+		t.Errorf("working directory = %q, want %s", w.Attributes.WorkingDirectory, ClusterSecondary)
+	}
+	want := pFlags.org + "/prod-my-idp-cluster-secondary"
+	if got, _ := tfc.variable("prod-my-idp-database-secondary", "tf_remote_cluster_secondary"); got != want {
+		t.Errorf("tf_remote_cluster_secondary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+)
+
+const awsCreateSecondary = "aws_create_secondary"
+
+// runPreflight checks that the secondary region is ready for failover and prints the result of each check. The
+// failed checks are returned.
+func runPreflight(tfc TerraformCloud, pFlags PersistentFlags) ([]AuditCheck, error) {
+	_, _ = fmt.Fprintln(pFlags.progress, "\nRunning pre-flight checks...")
+	a, err := newAudit(tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = a.checkSecondaryCreated(); err != nil {
+		return nil, err
+	}
+	for _, workspace := range secondaryWorkspaceOrder(pFlags) {
+		if err = a.checkWorkspaceReady(workspace); err != nil {
+			return nil, err
+		}
+	}
+	if err = a.checkStateOutputs(workspaceName(pFlags, DatabaseSecondary)); err != nil {
+		return nil, err
+	}
+
+	a.printSummary()
+	return a.failed(), nil
+}
+
+// checkSecondaryCreated checks that the core workspace is configured to create the secondary region resources
+func (a *audit) checkSecondaryCreated() error {
+	workspace := workspaceName(a.pFlags, Core)
+	check := fmt.Sprintf("var.%s is %q", awsCreateSecondary, "true")
+	if !a.exists(workspace, check) {
+		return nil
+	}
+
+	vars, err := a.getVariables(workspace)
+	if err != nil {
+		return err
+	}
+	v := findVar(vars, awsCreateSecondary)
+	switch {
+	case v == nil:
+		a.add(workspace, check, false, "variable is not set")
+	case v.Value != "true":
+		a.add(workspace, check, false, fmt.Sprintf("found %q", v.Value))
+	default:
+		a.add(workspace, check, true, "")
+	}
+	return nil
+}
+
+// checkWorkspaceReady checks that a workspace exists and is not locked, that no run is in progress, and that the
+// latest run was successful
+func (a *audit) checkWorkspaceReady(workspace string) error {
+	if !a.exists(workspace, "workspace exists") {
+		return nil
+	}
+	a.add(workspace, "workspace exists", true, "")
+
+	data, err := a.tfc.GetWorkspace(workspace)
+	if err != nil {
+		return err
+	}
+	a.add(workspace, "workspace is not locked", !data.Attributes.Locked, "")
+
+	runs, err := a.tfc.ListRuns(a.workspaceIDs[workspace])
+	if err != nil {
+		return fmt.Errorf("failed to list runs on workspace %q: %w", workspace, err)
+	}
+
+	var pending, latest *Run
+	for i := range runs {
+		if !runs[i].isFinished() {
+			if pending == nil {
+				pending = &runs[i]
+			}
+		} else if latest == nil {
+			latest = &runs[i]
+		}
+	}
+
+	if pending == nil {
+		a.add(workspace, "no run in progress", true, "")
+	} else {
+		a.add(workspace, "no run in progress", false, fmt.Sprintf("run %s is %s", pending.ID, pending.Status))
+	}
+
+	switch {
+	case latest == nil:
+		a.add(workspace, "latest run was applied", false, "workspace has no runs")
+	case !latest.isSuccessful():
+		a.add(workspace, "latest run was applied", false, fmt.Sprintf("run %s is %s", latest.ID, latest.Status))
+	default:
+		a.add(workspace, "latest run was applied", true, "")
+	}
+	return nil
+}
+
+// checkStateOutputs checks that the current state of a workspace has outputs, showing that its resources were
+// created
+func (a *audit) checkStateOutputs(workspace string) error {
+	if !a.exists(workspace, "state has outputs") {
+		return nil
+	}
+
+	outputs, err := a.tfc.ListStateOutputs(a.workspaceIDs[workspace])
+	if err != nil {
+		return err
+	}
+	if len(outputs) == 0 {
+		a.add(workspace, "state has outputs", false, "no outputs found")
+	} else {
+		a.add(workspace, "state has outputs", true, "")
+	}
+	return nil
+}
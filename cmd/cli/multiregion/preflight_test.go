@@ -0,0 +1,101 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+func TestPreflight(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+
+	failed, err := runPreflight(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("expected all checks to pass, got %+v", failed)
+	}
+}
+
+func TestPreflightFailures(t *testing.T) {
+	pFlags := testFlags()
+
+	tests := map[string]struct {
+		modify func(tfc *fakeTerraformCloud)
+		want   AuditCheck
+	}{
+		"not applied": {
+			modify: func(tfc *fakeTerraformCloud) {
+				tfc.failRuns[workspaceName(pFlags, IdBrokerSecondary)] = true
+				r, _ := tfc.CreateRun(tfc.workspaces[workspaceName(pFlags, IdBrokerSecondary)].workspace.ID, "test")
+				_, _ = tfc.GetRun(r.ID)
+			},
+			want: AuditCheck{Workspace: workspaceName(pFlags, IdBrokerSecondary), Check: "latest run was applied"},
+		},
+		"run in progress": {
+			modify: func(tfc *fakeTerraformCloud) {
+				_, _ = tfc.CreateRun(tfc.workspaces[workspaceName(pFlags, ClusterSecondary)].workspace.ID, "test")
+			},
+			want: AuditCheck{Workspace: workspaceName(pFlags, ClusterSecondary), Check: "no run in progress"},
+		},
+		"locked": {
+			modify: func(tfc *fakeTerraformCloud) {
+				tfc.workspaces[workspaceName(pFlags, PwManagerSecondary)].workspace.Attributes.Locked = true
+			},
+			want: AuditCheck{Workspace: workspaceName(pFlags, PwManagerSecondary), Check: "workspace is not locked"},
+		},
+		"missing workspace": {
+			modify: func(tfc *fakeTerraformCloud) {
+				delete(tfc.workspaces, workspaceName(pFlags, IdSyncSecondary))
+			},
+			want: AuditCheck{Workspace: workspaceName(pFlags, IdSyncSecondary), Check: "workspace exists"},
+		},
+		"secondary not created": {
+			modify: func(tfc *fakeTerraformCloud) {
+				for i, v := range tfc.workspaces[workspaceName(pFlags, Core)].variables {
+					if v.Key == awsCreateSecondary {
+						tfc.workspaces[workspaceName(pFlags, Core)].variables[i].Value = "false"
+					}
+				}
+			},
+			want: AuditCheck{Workspace: workspaceName(pFlags, Core), Check: `var.aws_create_secondary is "true"`},
+		},
+	}
+	for name, tt := range tests {
+		tfc := newTestAppliedIdp(t, pFlags)
+		tt.modify(tfc)
+
+		failed, err := runPreflight(tfc, pFlags)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(failed) != 1 || failed[0].Workspace != tt.want.Workspace || failed[0].Check != tt.want.Check {
+			t.Errorf("%s: expected failed check %q on %s, got %+v", name, tt.want.Check, tt.want.Workspace, failed)
+		}
+	}
+}
+
+func TestRunFailoverForce(t *testing.T) {
+	pFlags := testFlags()
+
+	// the secondary workspaces have never been applied, so the checks fail
+	tfc := newTestMultiregionIdp(t, pFlags)
+	err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute})
+	if !errors.Is(err, clierr.ErrAborted) {
+		t.Fatalf("expected failover to be refused, got %v", err)
+	}
+
+	setStdin(t, "test\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute, force: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), awsFailoverActive); got != "true" {
+		t.Errorf("%s = %q, want true", awsFailoverActive, got)
+	}
+}
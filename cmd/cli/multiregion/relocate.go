@@ -0,0 +1,235 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+type relocateOptions struct {
+	recreate bool
+	timeout  time.Duration
+
+	// zones lists the availability zones of a region, by default using the EC2 API
+	zones ZoneFinder
+}
+
+func InitRelocateCmd(parentCmd *cobra.Command) {
+	var opts relocateOptions
+
+	relocateCmd := &cobra.Command{
+		Use:   "relocate",
+		Short: "Move the secondary region",
+		Long: `Move the secondary region of a multiregion IdP to the region given by --region2. The variables that
+depend on the secondary region are updated after the changes are displayed and confirmed. Use --recreate to also
+destroy the secondary resources in the old region before the variables are changed, and then apply each secondary
+workspace in the new region. Relocation is refused while failover is active.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runRelocate(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), pFlags, opts)
+		},
+	}
+
+	parentCmd.AddCommand(relocateCmd)
+
+	relocateCmd.PersistentFlags().BoolVar(&opts.recreate, "recreate", false,
+		`destroy the secondary resources in the old region and apply them in the new region`,
+	)
+	relocateCmd.PersistentFlags().DurationVar(&opts.timeout, "timeout", defaultRunTimeout,
+		`maximum time to wait for each Terraform run to finish`,
+	)
+}
+
+// relocate computes the changes needed to move the secondary region of a multiregion IdP
+type relocate struct {
+	*setup
+
+	// oldRegion is the current secondary region
+	oldRegion string
+}
+
+func runRelocate(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags, opts relocateOptions) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
+	}
+
+	r, err := newRelocate(ctx, tfc, pFlags)
+	if err != nil {
+		return err
+	}
+	if opts.zones != nil {
+		r.zoneFinder = opts.zones
+	}
+	if err = r.checkFailoverInactive(); err != nil {
+		return err
+	}
+	plan, err := r.makePlan(opts.recreate)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintf(pFlags.progress, "\nRelocating secondary region from %s to %s\n", r.oldRegion,
+		pFlags.secondaryRegion)
+	printPlan(pFlags.progress, plan)
+
+	if pFlags.readOnlyMode || len(plan.Changes) == 0 {
+		output.Print(plan)
+		return nil
+	}
+
+	if !confirmDestructive(pFlags, "Please confirm relocation of the secondary region.") {
+		return clierr.ErrAborted
+	}
+
+	_, _ = fmt.Fprintln(pFlags.progress, "\nApplying changes...")
+	for _, c := range plan.Changes {
+		if err = applyRunOrChange(ctx, pFlags.progress, tfc, c, opts.timeout); err != nil {
+			return err
+		}
+	}
+
+	output.Print(plan)
+	_, _ = fmt.Fprintf(pFlags.progress, "\nSet %s to %s in the idp-cli config file to use the new secondary region.\n",
+		flags.Region2, pFlags.secondaryRegion)
+	return nil
+}
+
+func newRelocate(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags) (*relocate, error) {
+	if pFlags.secondaryRegion == pFlags.region {
+		return nil, fmt.Errorf("%w: the secondary region cannot be the same as the primary region %s",
+			clierr.ErrConfig, pFlags.region)
+	}
+
+	s, err := newSetup(ctx, tfc, pFlags)
+	if err != nil {
+		return nil, err
+	}
+	r := &relocate{setup: s}
+
+	for _, workspace := range append([]string{workspaceName(pFlags, Core)}, secondaryWorkspaceOrder(pFlags)...) {
+		if _, ok := r.workspaceIDs[workspace]; !ok {
+			return nil, fmt.Errorf("%w: workspace %s does not exist, run setup before relocate", clierr.ErrNotFound,
+				workspace)
+		}
+	}
+
+	vars, err := r.getVariables(workspaceName(pFlags, Core))
+	if err != nil {
+		return nil, err
+	}
+	v := findVar(vars, "aws_region_secondary")
+	if v == nil || v.Value == "" {
+		return nil, fmt.Errorf("%w: var.aws_region_secondary is not set in %s, run setup before relocate",
+			clierr.ErrNotFound, workspaceName(pFlags, Core))
+	}
+	r.oldRegion = v.Value
+	return r, nil
+}
+
+// makePlan returns the changes needed to move the secondary region. If recreate is true, the run triggers are
+// removed while the old secondary resources are destroyed and the workspaces are applied in the new region, so
+// that each run is started only once and in dependency order. All run triggers are restored at the end, including
+// any removed by an earlier relocation that did not finish.
+func (r *relocate) makePlan(recreate bool) (SetupPlan, error) {
+	plan := SetupPlan{Org: r.pFlags.org, Idp: r.pFlags.idp, Env: r.pFlags.env}
+	if r.oldRegion == r.pFlags.secondaryRegion {
+		_, _ = fmt.Fprintf(r.pFlags.progress, "The secondary region is already %s\n", r.oldRegion)
+		return plan, nil
+	}
+
+	if recreate {
+		if err := r.planRunTriggerRemoval(); err != nil {
+			return plan, err
+		}
+
+		_, _ = fmt.Fprintln(r.pFlags.progress, "\nChecking destroy runs...")
+		destroyOrder := slices.Clone(secondaryWorkspaceOrder(r.pFlags))
+		slices.Reverse(destroyOrder)
+		r.planRuns(changeTypeDestroyRun, destroyOrder, "relocate secondary region from "+r.oldRegion)
+	}
+
+	if err := r.planRegionVariables(); err != nil {
+		return plan, err
+	}
+
+	if recreate {
+		_, _ = fmt.Fprintln(r.pFlags.progress, "\nChecking apply runs...")
+		r.planRuns(changeTypeApplyRun, secondaryWorkspaceOrder(r.pFlags),
+			"relocate secondary region to "+r.pFlags.secondaryRegion)
+		for _, trigger := range getRunTriggers(r.pFlags) {
+			r.add(SetupChange{
+				Workspace: trigger.workspace,
+				Type:      changeTypeRunTrigger,
+				Action:    changeActionCreate,
+				Key:       trigger.source,
+			})
+		}
+	}
+
+	plan.Changes = r.changes
+	return plan, nil
+}
+
+// planRegionVariables plans changes to the multiregion variables that depend on the secondary region. The core
+// workspace is changed last because its aws_region_secondary variable records the current secondary region, so an
+// interrupted relocation can be run again.
+func (r *relocate) planRegionVariables() error {
+	_, _ = fmt.Fprintln(r.pFlags.progress, "\nChecking secondary region variables...")
+
+	oldZones, err := availabilityZones(r.ctx, r.zoneFinder, r.oldRegion)
+	if err != nil {
+		return err
+	}
+	oldFlags := r.pFlags
+	oldFlags.secondaryRegion = r.oldRegion
+	oldVariables := getMultiregionVariables(oldFlags, oldZones)
+
+	zones, err := availabilityZones(r.ctx, r.zoneFinder, r.pFlags.secondaryRegion)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(r.pFlags.progress, "Availability zones in %s: %s\n", r.pFlags.secondaryRegion,
+		strings.Join(zones, ", "))
+	newVariables := getMultiregionVariables(r.pFlags, zones)
+	order := make([]int, 0, len(newVariables))
+	for i, w := range newVariables {
+		if w.workspace != workspaceName(r.pFlags, Core) {
+			order = append(order, i)
+		}
+	}
+	for i, w := range newVariables {
+		if w.workspace == workspaceName(r.pFlags, Core) {
+			order = append(order, i)
+		}
+	}
+
+	for _, i := range order {
+		w := newVariables[i]
+		currentVars, err := r.getVariables(w.workspace)
+		if err != nil {
+			return err
+		}
+		for j, tfVar := range w.variables {
+			if tfVar.Value == oldVariables[i].variables[j].Value {
+				continue
+			}
+			r.planVariable(currentVars, w.workspace, tfVar)
+		}
+	}
+	return nil
+}
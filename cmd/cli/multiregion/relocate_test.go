@@ -0,0 +1,84 @@
+package multiregion
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRelocate(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	mutations := tfc.mutations
+
+	pFlags.secondaryRegion = "us-east-2"
+	setStdin(t, "test\n")
+	if err := runRelocate(context.Background(), tfc, pFlags, relocateOptions{timeout: time.Minute, zones: testZones}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, Core), "aws_region_secondary"); got != "us-east-2" {
+		t.Errorf("aws_region_secondary = %q, want us-east-2", got)
+	}
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), "aws_zones"); !strings.Contains(got, `"us-east-2a"`) ||
+		strings.Contains(got, "us-west-2") {
+		t.Errorf("aws_zones = %s, want us-east-2 zones", got)
+	}
+	if got, _ := tfc.variable(workspaceName(pFlags, DatabaseSecondary), "availability_zone"); got != "us-east-2a" {
+		t.Errorf("availability_zone = %q, want us-east-2a", got)
+	}
+
+	// only the three variables that depend on the secondary region are changed
+	if n := tfc.mutations - mutations; n != 3 {
+		t.Errorf("expected 3 changes, got %d", n)
+	}
+	if runs := tfc.workspaceRuns(workspaceName(pFlags, ClusterSecondary)); len(runs) != 0 {
+		t.Errorf("expected no runs without --recreate, got %d", len(runs))
+	}
+}
+
+func TestRunRelocateRecreate(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	pFlags.secondaryRegion = "us-east-2"
+	setStdin(t, "test\n")
+	if err := runRelocate(context.Background(), tfc, pFlags, relocateOptions{recreate: true, timeout: time.Minute, zones: testZones}); err != nil {
+		t.Fatal(err)
+	}
+
+	// each workspace is destroyed and then applied once, since run triggers are removed while the runs are made
+	for _, workspace := range secondaryWorkspaceOrder(pFlags) {
+		runs := tfc.workspaceRuns(workspace)
+		if len(runs) != 2 || !runs[0].IsDestroy || runs[1].IsDestroy || runs[1].Status != runStatusApplied {
+			t.Errorf("%s: expected a destroy run and an applied run, got %+v", workspace, runs)
+		}
+	}
+
+	for _, trigger := range getRunTriggers(pFlags) {
+		found, _ := tfc.FindRunTrigger(tfc.workspaces[trigger.workspace].workspace.ID,
+			tfc.workspaces[trigger.source].workspace.ID)
+		if !found {
+			t.Errorf("run trigger %s -> %s was not restored", trigger.source, trigger.workspace)
+		}
+	}
+}
+
+func TestRelocateSameRegion(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	r, err := newRelocate(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.zoneFinder = testZones
+	plan, err := r.makePlan(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", plan.Changes)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+)
+
+// Default retry settings for API requests
+const (
+	defaultMaxAttempts = 5
+	defaultApiTimeout  = 2 * time.Minute
+)
+
+// InitApiFlags adds the flags that control how failed API requests are retried
+func InitApiFlags(parentCmd *cobra.Command) {
+	flags.NewIntFlag(parentCmd, flags.ApiMaxAttempts, "", defaultMaxAttempts,
+		"maximum number of attempts for a Terraform Cloud or Cloudflare API request")
+	flags.NewDurationFlag(parentCmd, flags.ApiTimeout, "", defaultApiTimeout,
+		"maximum total time for a Terraform Cloud or Cloudflare API request, including retries")
+}
+
+// retryPolicy controls how a failed API request is retried
+type retryPolicy struct {
+	// maxAttempts is the maximum number of times a request is sent, including the first attempt
+	maxAttempts int
+
+	// timeout is the maximum total time for a request, including all attempts and the time waiting between them
+	timeout time.Duration
+
+	// baseDelay is the time to wait before the first retry. The delay doubles for each retry after that.
+	baseDelay time.Duration
+
+	// maxDelay is the longest time to wait between attempts, unless the server asks for a longer wait
+	maxDelay time.Duration
+}
+
+// getRetryPolicy reads the retry policy from the 'api-max-attempts' and 'api-timeout' parameters
+func getRetryPolicy() (retryPolicy, error) {
+	p := retryPolicy{
+		maxAttempts: defaultMaxAttempts,
+		timeout:     defaultApiTimeout,
+		baseDelay:   time.Second,
+		maxDelay:    30 * time.Second,
+	}
+	if viper.IsSet(flags.ApiMaxAttempts) {
+		p.maxAttempts = viper.GetInt(flags.ApiMaxAttempts)
+	}
+	if viper.IsSet(flags.ApiTimeout) {
+		p.timeout = viper.GetDuration(flags.ApiTimeout)
+	}
+
+	if p.maxAttempts < 1 {
+		return retryPolicy{}, fmt.Errorf("%w: %s must be at least 1", clierr.ErrConfig, flags.ApiMaxAttempts)
+	}
+	if p.timeout <= 0 {
+		return retryPolicy{}, fmt.Errorf("%w: %s must be greater than zero", clierr.ErrConfig, flags.ApiTimeout)
+	}
+	return p, nil
+}
+
+// retryTransport is an http.RoundTripper that retries requests that fail with a transient error. A request is
+// retried if the server responds with 429 Too Many Requests. Other requests, except POST, are also retried after a
+// network error or a 5xx response. A POST is not repeated in that case because the first attempt may have been
+// processed, e.g. a run may have been created. The wait between attempts doubles each time, with some jitter, or is
+// the time given by a Retry-After header. Waiting stops early if the request context is canceled.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retryPolicy
+}
+
+func newRetryTransport(next http.RoundTripper, policy retryPolicy) *retryTransport {
+	return &retryTransport{next: next, policy: policy}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	deadline := time.Now().Add(t.policy.timeout)
+
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.Body != nil {
+			// the body of the previous attempt was consumed, so send a fresh copy
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if !t.shouldRetry(req, resp, err) || attempt >= t.policy.maxAttempts {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = d
+			}
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			// read the rest of the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// shouldRetry returns true if the request can be retried after the given response or error
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if req.Method == http.MethodPost {
+		return false
+	}
+	return err != nil || resp.StatusCode >= 500
+}
+
+// backoff returns the time to wait after the given attempt: the base delay doubled for each earlier retry, up to the
+// maximum delay, less a random jitter of up to a quarter so that concurrent requests do not retry in step
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := t.policy.maxDelay
+	if attempt < 32 {
+		delay = min(t.policy.baseDelay<<(attempt-1), t.policy.maxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay - rand.N(delay/4+1)
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// interruptedError returns an error wrapped with clierr.ErrAborted if the context was canceled, e.g. by Ctrl-C, or
+// the original error otherwise
+func interruptedError(ctx context.Context, err error) error {
+	if ctx.Err() == context.Canceled {
+		return fmt.Errorf("%w: interrupted: %w", clierr.ErrAborted, err)
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package multiregion
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = retryPolicy{
+	maxAttempts: 3,
+	timeout:     time.Minute,
+	baseDelay:   time.Millisecond,
+	maxDelay:    10 * time.Millisecond,
+}
+
+// newRetryTestServer returns a server that responds with the given status codes in turn, then 200 OK, and a pointer
+// to the number of requests received
+func newRetryTestServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && string(body) != "payload" {
+			t.Errorf("request %d has body %q, want payload", requests+1, body)
+		}
+		status := http.StatusOK
+		if requests < len(statuses) {
+			status = statuses[requests]
+		}
+		requests++
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func doRetryRequest(t *testing.T, ctx context.Context, policy retryPolicy, method, url string) (int, error) {
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader("payload")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, policy)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		wantStatus   int
+		wantRequests int
+	}{
+		{"success", http.MethodGet, nil, http.StatusOK, 1},
+		{"rate limited", http.MethodGet, []int{429, 429}, http.StatusOK, 3},
+		{"server error", http.MethodPatch, []int{502}, http.StatusOK, 2},
+		{"max attempts", http.MethodGet, []int{503, 503, 503, 503}, http.StatusServiceUnavailable, 3},
+		{"client error", http.MethodGet, []int{404}, http.StatusNotFound, 1},
+		{"post rate limited", http.MethodPost, []int{429}, http.StatusOK, 2},
+		{"post server error", http.MethodPost, []int{500}, http.StatusInternalServerError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newRetryTestServer(t, nil, tt.statuses...)
+
+			status, err := doRetryRequest(t, context.Background(), testRetryPolicy, tt.method, server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if *requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", *requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetryAfterDeadline(t *testing.T) {
+	server, requests := newRetryTestServer(t, http.Header{"Retry-After": {"60"}}, 429)
+
+	policy := testRetryPolicy
+	policy.timeout = time.Second
+	status, err := doRetryRequest(t, context.Background(), policy, http.MethodGet, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusTooManyRequests || *requests != 1 {
+		t.Errorf("got status %d after %d requests, want 429 without waiting past the deadline", status, *requests)
+	}
+}
+
+func TestRetryTransportCanceled(t *testing.T) {
+	server, requests := newRetryTestServer(t, http.Header{"Retry-After": {"30"}}, 429)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := doRetryRequest(t, ctx, testRetryPolicy, http.MethodGet, server.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > 10*time.Second || *requests != 1 {
+		t.Errorf("request was not canceled while waiting to retry")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"Tue, 02 Jan 2024 03:04:35 GMT", 30 * time.Second, true},
+		{"Tue, 02 Jan 2024 03:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
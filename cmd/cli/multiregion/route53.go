@@ -0,0 +1,119 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// defaultRoute53TTL is the TTL used when creating a record in Route 53
+const defaultRoute53TTL = 300
+
+// route53Provider is the DNSProvider implementation that calls the AWS Route 53 API. Route 53 does not assign IDs to
+// records, so the record name is used as the ID. Requests are canceled when the context is canceled.
+type route53Provider struct {
+	ctx          context.Context
+	client       *route53.Client
+	hostedZoneID string
+}
+
+func newRoute53Provider(ctx context.Context, w io.Writer, cfg aws.Config, domainName string) (DNSProvider, error) {
+	client := route53.NewFromConfig(cfg)
+
+	zones, err := client.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(domainName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Route 53 API call failed to find hosted zone %s: %w", domainName, err)
+	}
+
+	for _, zone := range zones.HostedZones {
+		if trimDot(aws.ToString(zone.Name)) == domainName {
+			_, _ = fmt.Fprintf(w, "Using domain name %s with ID %s\n", domainName, aws.ToString(zone.Id))
+			return &route53Provider{
+				ctx:          ctx,
+				client:       client,
+				hostedZoneID: aws.ToString(zone.Id),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("did not find a Route 53 hosted zone for %s", domainName)
+}
+
+func (r *route53Provider) FindRecord(name string) (*DnsRecord, error) {
+	sets, err := r.client.ListResourceRecordSets(r.ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.hostedZoneID),
+		StartRecordName: aws.String(name),
+		MaxItems:        aws.Int32(10),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Route 53 API call failed to find DNS record %s: %w", name, err)
+	}
+
+	// record sets are listed in order starting with the given name, so stop at the first one with another name
+	for _, set := range sets.ResourceRecordSets {
+		if trimDot(aws.ToString(set.Name)) != name {
+			break
+		}
+		if set.Type != types.RRTypeCname {
+			continue
+		}
+		if len(set.ResourceRecords) != 1 {
+			return nil, fmt.Errorf("DNS record %s has %d values", name, len(set.ResourceRecords))
+		}
+		return &DnsRecord{
+			ID:      name,
+			Type:    string(set.Type),
+			Name:    name,
+			Content: trimDot(aws.ToString(set.ResourceRecords[0].Value)),
+			TTL:     int(aws.ToInt64(set.TTL)),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (r *route53Provider) UpdateRecord(record DnsRecord) error {
+	return r.changeRecord(types.ChangeActionUpsert, record)
+}
+
+func (r *route53Provider) CreateRecord(record DnsRecord) error {
+	return r.changeRecord(types.ChangeActionCreate, record)
+}
+
+func (r *route53Provider) changeRecord(action types.ChangeAction, record DnsRecord) error {
+	ttl := record.TTL
+	if ttl == 0 {
+		ttl = defaultRoute53TTL
+	}
+
+	_, err := r.client.ChangeResourceRecordSets(r.ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.hostedZoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String("idp-cli"),
+			Changes: []types.Change{{
+				Action: action,
+				ResourceRecordSet: &types.ResourceRecordSet{
+					Name:            aws.String(record.Name),
+					Type:            types.RRType(record.Type),
+					TTL:             aws.Int64(int64(ttl)),
+					ResourceRecords: []types.ResourceRecord{{Value: aws.String(record.Content)}},
+				},
+			}},
+		},
+	})
+	return err
+}
+
+// trimDot removes the trailing dot from a fully-qualified domain name as returned by Route 53
+func trimDot(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
@@ -0,0 +1,252 @@
+package multiregion
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const route53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+type route53RecordSet struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int64    `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+// route53StandIn is a local HTTP server that implements the parts of the Route 53 API used by route53Provider, for
+// a single hosted zone containing CNAME records
+type route53StandIn struct {
+	*httptest.Server
+	domainName string
+	records    map[string]string
+	changes    []string
+}
+
+func newRoute53StandIn(t *testing.T, domainName string, cnames map[string]string) *route53StandIn {
+	s := &route53StandIn{domainName: domainName, records: map[string]string{}}
+	for name, value := range cnames {
+		s.records[name+"."] = value
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /2013-04-01/hostedzonesbyname", s.listHostedZones)
+	mux.HandleFunc("GET /2013-04-01/hostedzone/Z123/rrset", s.listRecordSets)
+	mux.HandleFunc("POST /2013-04-01/hostedzone/Z123/rrset", s.changeRecordSets)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected Route 53 request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *route53StandIn) config() aws.Config {
+	return aws.Config{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(s.URL),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, nil
+		}),
+	}
+}
+
+func (s *route53StandIn) writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "text/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func (s *route53StandIn) listHostedZones(w http.ResponseWriter, r *http.Request) {
+	type hostedZone struct {
+		ID              string `xml:"Id"`
+		Name            string `xml:"Name"`
+		CallerReference string `xml:"CallerReference"`
+	}
+	s.writeXML(w, struct {
+		XMLName     xml.Name     `xml:"ListHostedZonesByNameResponse"`
+		Xmlns       string       `xml:"xmlns,attr"`
+		HostedZones []hostedZone `xml:"HostedZones>HostedZone"`
+		IsTruncated bool         `xml:"IsTruncated"`
+		MaxItems    int          `xml:"MaxItems"`
+	}{
+		Xmlns:       route53Namespace,
+		HostedZones: []hostedZone{{ID: "/hostedzone/Z123", Name: s.domainName + ".", CallerReference: "test"}},
+		MaxItems:    100,
+	})
+}
+
+func (s *route53StandIn) listRecordSets(w http.ResponseWriter, r *http.Request) {
+	start := r.URL.Query().Get("name")
+	if !strings.HasSuffix(start, ".") {
+		start += "."
+	}
+
+	var sets []route53RecordSet
+	for _, name := range sortedKeys(s.records) {
+		if name >= start {
+			sets = append(sets, route53RecordSet{Name: name, Type: "CNAME", TTL: 300, Values: []string{s.records[name]}})
+		}
+	}
+
+	s.writeXML(w, struct {
+		XMLName     xml.Name           `xml:"ListResourceRecordSetsResponse"`
+		Xmlns       string             `xml:"xmlns,attr"`
+		Sets        []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+		IsTruncated bool               `xml:"IsTruncated"`
+		MaxItems    int                `xml:"MaxItems"`
+	}{
+		Xmlns:    route53Namespace,
+		Sets:     sets,
+		MaxItems: 10,
+	})
+}
+
+func (s *route53StandIn) changeRecordSets(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Changes []struct {
+			Action string           `xml:"Action"`
+			Set    route53RecordSet `xml:"ResourceRecordSet"`
+		} `xml:"ChangeBatch>Changes>Change"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, c := range request.Changes {
+		name := c.Set.Name
+		if !strings.HasSuffix(name, ".") {
+			name += "."
+		}
+		_, exists := s.records[name]
+		if c.Action == "CREATE" && exists || c.Set.Type != "CNAME" || len(c.Set.Values) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.records[name] = c.Set.Values[0]
+		s.changes = append(s.changes, c.Action+" "+name)
+	}
+
+	s.writeXML(w, struct {
+		XMLName     xml.Name `xml:"ChangeResourceRecordSetsResponse"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		ID          string   `xml:"ChangeInfo>Id"`
+		Status      string   `xml:"ChangeInfo>Status"`
+		SubmittedAt string   `xml:"ChangeInfo>SubmittedAt"`
+	}{
+		Xmlns:       route53Namespace,
+		ID:          "/change/C123",
+		Status:      "PENDING",
+		SubmittedAt: "2024-01-01T00:00:00Z",
+	})
+}
+
+func TestRoute53Failover(t *testing.T) {
+	pFlags := testFlags()
+	server := newRoute53StandIn(t, testDomain, testDnsRecords(pFlags.region))
+
+	dns, err := newRoute53Provider(context.Background(), os.Stdout, server.config(), testDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "yes\nyes\n")
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+
+	for _, name := range []string{"test", "test-pw-api"} {
+		want := name + "-" + pFlags.secondaryRegion + "." + testDomain
+		if got := server.records[name+"."+testDomain+"."]; got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+	if got := server.records["mfa-api."+testDomain+"."]; got != "mfa-api-"+pFlags.region+"."+testDomain {
+		t.Errorf("mfa-api should not change, got %s", got)
+	}
+	for _, r := range d.records {
+		if r.Status != dnsStatusUpdated {
+			t.Errorf("%s status = %s, want %s", r.Name, r.Status, dnsStatusUpdated)
+		}
+	}
+}
+
+func TestRoute53AlreadySet(t *testing.T) {
+	pFlags := testFlags()
+	records := testDnsRecords(pFlags.secondaryRegion)
+
+	// Route 53 may return values as fully-qualified names
+	records["test."+testDomain] += "."
+	server := newRoute53StandIn(t, testDomain, records)
+
+	dns, err := newRoute53Provider(context.Background(), os.Stdout, server.config(), testDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, true)
+	d.setDnsRecordValues(pFlags.idp)
+
+	if len(server.changes) != 0 {
+		t.Errorf("expected no changes, got %v", server.changes)
+	}
+	for _, r := range d.records {
+		if r.Status != dnsStatusUnchanged {
+			t.Errorf("%s status = %s, want %s", r.Name, r.Status, dnsStatusUnchanged)
+		}
+	}
+}
+
+func TestRoute53ReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.readOnlyMode = true
+	server := newRoute53StandIn(t, testDomain, map[string]string{"test." + testDomain: "test-us-east-1." + testDomain})
+
+	dns, err := newRoute53Provider(context.Background(), os.Stdout, server.config(), testDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+
+	if len(server.changes) != 0 {
+		t.Errorf("read-only mode made changes: %v", server.changes)
+	}
+}
+
+func TestRoute53Create(t *testing.T) {
+	pFlags := testFlags()
+	server := newRoute53StandIn(t, testDomain, map[string]string{"test." + testDomain: "test-us-east-1." + testDomain})
+
+	dns, err := newRoute53Provider(context.Background(), os.Stdout, server.config(), testDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "yes\nyes\n")
+	d := newDnsCommand(pFlags, dns, testDomain, false, false)
+	d.setDnsRecordValues(pFlags.idp)
+
+	want := []string{"CREATE test-pw-api." + testDomain + ".", "UPSERT test." + testDomain + "."}
+	if !slices.Equal(server.changes, want) {
+		t.Errorf("changes = %v, want %v", server.changes, want)
+	}
+}
+
+func TestRoute53HostedZoneNotFound(t *testing.T) {
+	server := newRoute53StandIn(t, testDomain, nil)
+
+	if _, err := newRoute53Provider(context.Background(), os.Stdout, server.config(), "example.com"); err == nil {
+		t.Error("expected an error for a domain without a hosted zone")
+	}
+}
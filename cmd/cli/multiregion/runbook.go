@@ -0,0 +1,124 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Runbook step status values
+const (
+	stepStatusDone    = "done"
+	stepStatusFailed  = "failed"
+	stepStatusSkipped = "skipped"
+)
+
+// RunbookStep is the result of one step of the full failover runbook
+type RunbookStep struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// runbookLog runs a fixed sequence of steps, printing each step as it starts and finishes. Once a step fails, the
+// remaining steps are skipped.
+type runbookLog struct {
+	progress io.Writer
+	names    []string
+	steps    []RunbookStep
+	err      error
+}
+
+// run runs the next step, unless a previous step failed. The step function returns a short description of the
+// outcome.
+func (r *runbookLog) run(step func() (string, error)) {
+	name := r.names[len(r.steps)]
+	if r.err != nil {
+		r.steps = append(r.steps, RunbookStep{Name: name, Status: stepStatusSkipped})
+		return
+	}
+
+	_, _ = fmt.Fprintf(r.progress, "\n==> Step %d of %d: %s\n", len(r.steps)+1, len(r.names), name)
+	start := time.Now()
+	detail, err := step()
+
+	s := RunbookStep{Name: name, Status: stepStatusDone, Detail: detail}
+	if err != nil {
+		s.Status = stepStatusFailed
+		s.Detail = err.Error()
+		r.err = fmt.Errorf("%s: %w", name, err)
+	}
+	r.steps = append(r.steps, s)
+	_, _ = fmt.Fprintf(r.progress, "<== %s in %s\n", s.Status, time.Since(start).Round(time.Second))
+}
+
+func (r *runbookLog) print() {
+	_, _ = fmt.Fprintln(r.progress, "\nFailover step log:")
+	for i, s := range r.steps {
+		if s.Detail == "" {
+			_, _ = fmt.Fprintf(r.progress, "  %d. %-40s %s\n", i+1, s.Name, s.Status)
+		} else {
+			_, _ = fmt.Fprintf(r.progress, "  %d. %-40s %s (%s)\n", i+1, s.Name, s.Status, s.Detail)
+		}
+	}
+}
+
+// runbook activates failover mode, waits for the secondary cluster, database, and application runs to apply, and
+// then switches DNS records to the secondary region. DNS records are not changed if any run fails.
+func (f *Failover) runbook(d *DnsCommand, idpKey string, timeout time.Duration) (FailoverResult, error) {
+	result := FailoverResult{
+		Workspace: f.workspaces[ClusterSecondary].Attributes.Name,
+		Variable:  awsFailoverActive,
+		Value:     "true",
+	}
+
+	r := runbookLog{progress: f.progress, names: []string{
+		"Set " + awsFailoverActive + " to true",
+		"Wait for Terraform runs to apply",
+		"Switch DNS to secondary region",
+	}}
+
+	var run Run
+	r.run(func() (string, error) {
+		var err error
+		if result.PreviousValue, err = f.setFailoverActiveVariable("true"); err != nil {
+			return "", err
+		}
+		if run, err = f.createRun(ClusterSecondary, "set "+awsFailoverActive+" to true"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("previous value was %q", result.PreviousValue), nil
+	})
+
+	r.run(func() (string, error) {
+		var err error
+		result.Runs, err = f.waitForRuns(ClusterSecondary, run, timeout)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d runs applied", len(result.Runs)), nil
+	})
+
+	r.run(func() (string, error) {
+		err := d.setDnsRecordValues(idpKey)
+		result.DnsRecords = d.records
+		if err != nil {
+			return "", err
+		}
+
+		counts := map[string]int{}
+		for _, rec := range d.records {
+			counts[rec.Status]++
+		}
+		return fmt.Sprintf("%d updated, %d created, %d unchanged, %d skipped", counts[dnsStatusUpdated],
+			counts[dnsStatusCreated], counts[dnsStatusUnchanged], counts[dnsStatusSkipped]), nil
+	})
+
+	r.print()
+	result.Steps = r.steps
+	return result, r.err
+}
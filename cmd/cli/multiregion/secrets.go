@@ -0,0 +1,225 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+)
+
+// Sources of sensitive variable values
+const (
+	secretsSourcePrompt = "prompt"
+	secretsSourceEnv    = "env"
+	secretsSourceFile   = "file"
+)
+
+// secretsPassphraseEnv is the environment variable holding the passphrase of an encrypted secrets file. If it is
+// not set, the passphrase is requested interactively.
+const secretsPassphraseEnv = "IDP_CLI_SECRETS_PASSPHRASE"
+
+// secretSource provides the values of sensitive variables
+type secretSource interface {
+	// secret returns the value of a sensitive variable in a workspace
+	secret(workspace, key string) (string, error)
+}
+
+// newSecretSource returns the secret source selected by the secrets-source setting
+func newSecretSource(w io.Writer) (secretSource, error) {
+	source := getOption(flags.SecretsSource, secretsSourcePrompt)
+	switch source {
+	case secretsSourcePrompt:
+		if viper.GetBool(flags.NonInteractive) {
+			return nil, fmt.Errorf("%w: %s %q cannot be used with --%s, use %q or %q", clierr.ErrConfig,
+				flags.SecretsSource, source, flags.NonInteractive, secretsSourceEnv, secretsSourceFile)
+		}
+		return promptSecrets{progress: w}, nil
+	case secretsSourceEnv:
+		return envSecrets{}, nil
+	case secretsSourceFile:
+		filename, err := getRequiredParam(flags.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+		return readSecretsFile(filename, func() (string, error) { return secretsPassphrase(w) })
+	}
+	return nil, fmt.Errorf("%w: unrecognized %s %q, must be %q, %q, or %q", clierr.ErrConfig, flags.SecretsSource,
+		source, secretsSourcePrompt, secretsSourceEnv, secretsSourceFile)
+}
+
+// readSecrets gets the value of every sensitive variable in a list of changes. The values are returned in a map
+// keyed by secretKey, so they are never stored in a plan or journal. The secret source is only created if there is
+// at least one sensitive variable.
+func readSecrets(newSource func() (secretSource, error), changes []SetupChange) (map[string]string, error) {
+	secrets := map[string]string{}
+	var source secretSource
+	for _, c := range changes {
+		if !c.Sensitive {
+			continue
+		}
+		if _, ok := secrets[secretKey(c.Workspace, c.Key)]; ok {
+			continue
+		}
+		if source == nil {
+			var err error
+			if source, err = newSource(); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := source.secret(c.Workspace, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", clierr.ErrConfig, err)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%w: no value was given for %s var.%s", clierr.ErrConfig, c.Workspace, c.Key)
+		}
+		secrets[secretKey(c.Workspace, c.Key)] = value
+	}
+	return secrets, nil
+}
+
+func secretKey(workspace, key string) string {
+	return workspace + "/" + key
+}
+
+// promptSecrets requests each value interactively, without echoing the input
+type promptSecrets struct {
+	progress io.Writer
+}
+
+func (p promptSecrets) secret(workspace, key string) (string, error) {
+	return readHidden(p.progress, fmt.Sprintf("Enter the value of sensitive variable %s in %s:", key, workspace))
+}
+
+// envSecrets reads each value from an environment variable named after the workspace and key, as given by
+// secretEnvName
+type envSecrets struct{}
+
+func (envSecrets) secret(workspace, key string) (string, error) {
+	name := secretEnvName(workspace, key)
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set, it must contain %s var.%s", name, workspace, key)
+	}
+	return value, nil
+}
+
+// secretEnvName returns the name of the environment variable for a sensitive variable. For example, var.db_password
+// in workspace idp-myidp-prod-040-id-broker-secondary is read from
+// IDP_CLI_SECRET_IDP_MYIDP_PROD_040_ID_BROKER_SECONDARY_DB_PASSWORD.
+func secretEnvName(workspace, key string) string {
+	toEnv := func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}
+	return "IDP_CLI_SECRET_" + strings.Map(toEnv, workspace) + "_" + strings.Map(toEnv, key)
+}
+
+// fileSecrets holds the values read from a secrets file, as a map of workspace names (key) and variables (value)
+type fileSecrets struct {
+	filename string
+	values   map[string]map[string]string
+}
+
+// readSecretsFile reads a JSON secrets file encrypted with an age passphrase, such as one created by
+// "age --passphrase --armor -o secrets.age secrets.json". The file contains an object for each workspace, keyed by
+// workspace name, containing the sensitive variables for that workspace.
+func readSecretsFile(filename string, passphrase func() (string, error)) (fileSecrets, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fileSecrets{}, fmt.Errorf("%w: failed to open secrets file: %w", clierr.ErrConfig, err)
+	}
+	defer f.Close()
+
+	pass, err := passphrase()
+	if err != nil {
+		return fileSecrets{}, fmt.Errorf("%w: failed to read secrets file passphrase: %w", clierr.ErrConfig, err)
+	}
+	identity, err := age.NewScryptIdentity(pass)
+	if err != nil {
+		return fileSecrets{}, fmt.Errorf("%w: invalid secrets file passphrase: %w", clierr.ErrConfig, err)
+	}
+
+	// accept both binary and ASCII-armored files
+	in := bufio.NewReader(f)
+	var src io.Reader = in
+	if header, _ := in.Peek(len(armor.Header)); string(header) == armor.Header {
+		src = armor.NewReader(in)
+	}
+
+	r, err := age.Decrypt(src, identity)
+	if err != nil {
+		return fileSecrets{}, fmt.Errorf("%w: failed to decrypt secrets file %s: %w", clierr.ErrConfig, filename, err)
+	}
+
+	s := fileSecrets{filename: filename}
+	if err = json.NewDecoder(r).Decode(&s.values); err != nil {
+		return fileSecrets{}, fmt.Errorf("%w: failed to decode secrets file %s: %w", clierr.ErrConfig, filename, err)
+	}
+	return s, nil
+}
+
+func (s fileSecrets) secret(workspace, key string) (string, error) {
+	value, ok := s.values[workspace][key]
+	if !ok {
+		return "", fmt.Errorf("secrets file %s does not contain %s var.%s", s.filename, workspace, key)
+	}
+	return value, nil
+}
+
+// secretsPassphrase returns the secrets file passphrase from the environment, or requests it interactively
+func secretsPassphrase(w io.Writer) (string, error) {
+	if pass := os.Getenv(secretsPassphraseEnv); pass != "" {
+		return pass, nil
+	}
+	if viper.GetBool(flags.NonInteractive) {
+		return "", fmt.Errorf("%s must be set with --%s", secretsPassphraseEnv, flags.NonInteractive)
+	}
+	return readHidden(w, "Enter the secrets file passphrase:")
+}
+
+// readHidden prints a prompt and reads one line of input. Input from a terminal is not echoed.
+func readHidden(w io.Writer, message string) (string, error) {
+	_, _ = fmt.Fprintln(w, message)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(w)
+		return string(b), err
+	}
+
+	// read one byte at a time so that no input is consumed beyond the end of the line
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 1 && b[0] != '\n' {
+			line = append(line, b[0])
+		}
+		if n == 1 && b[0] == '\n' || err == io.EOF {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
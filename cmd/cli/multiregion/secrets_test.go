@@ -0,0 +1,149 @@
+package multiregion
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func TestSecretEnvName(t *testing.T) {
+	got := secretEnvName("idp-myidp-prod-040-id-broker-secondary", "db_password")
+	if want := "IDP_CLI_SECRET_IDP_MYIDP_PROD_040_ID_BROKER_SECONDARY_DB_PASSWORD"; got != want {
+		t.Errorf("secretEnvName = %s, want %s", got, want)
+	}
+}
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv(secretEnvName("ws", "key"), "value")
+
+	if got, err := (envSecrets{}).secret("ws", "key"); err != nil || got != "value" {
+		t.Errorf("secret = %q, %v, want value", got, err)
+	}
+	if _, err := (envSecrets{}).secret("ws", "other"); err == nil {
+		t.Error("expected an error for a missing environment variable")
+	}
+}
+
+func TestPromptSecrets(t *testing.T) {
+	setStdin(t, "value with spaces\nyes\n")
+
+	if got, err := (promptSecrets{progress: os.Stdout}).secret("ws", "key"); err != nil || got != "value with spaces" {
+		t.Errorf("secret = %q, %v, want %q", got, err, "value with spaces")
+	}
+
+	// input after the secret is left for the next prompt
+	if got := simplePrompt(os.Stdout, "next"); got != "yes" {
+		t.Errorf("next prompt read %q, want yes", got)
+	}
+}
+
+func TestReadSecretsFile(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+
+	for _, armored := range []bool{false, true} {
+		filename := writeSecretsFile(t, passphrase, armored, `{"ws": {"key": "value"}}`)
+
+		s, err := readSecretsFile(filename, func() (string, error) { return passphrase, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.secret("ws", "key"); err != nil || got != "value" {
+			t.Errorf("armored=%t: secret = %q, %v, want value", armored, got, err)
+		}
+		if _, err := s.secret("ws", "other"); err == nil {
+			t.Errorf("armored=%t: expected an error for a missing secret", armored)
+		}
+	}
+}
+
+func TestSecretsNotSavedInJournal(t *testing.T) {
+	pFlags := testFlags()
+	journalFile := filepath.Join(t.TempDir(), "journal.json")
+	change := SetupChange{
+		Workspace: workspaceName(pFlags, IdBrokerSecondary),
+		Type:      changeTypeVariable,
+		Action:    changeActionCreate,
+		Key:       "db_password",
+		Sensitive: true,
+	}
+
+	j, err := newSetupJournal(SetupPlan{Org: pFlags.org, Idp: pFlags.idp, Env: pFlags.env,
+		Changes: []SetupChange{change}}, journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.secrets, err = readSecrets(func() (secretSource, error) { return testSecrets(pFlags), nil }, j.pendingChanges())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secondary-db-password") {
+		t.Error("a sensitive value was saved in the journal")
+	}
+}
+
+func TestReadSecretsOnlyWhenNeeded(t *testing.T) {
+	changes := []SetupChange{{Workspace: "ws", Type: changeTypeVariable, Action: changeActionCreate, Key: "key"}}
+
+	_, err := readSecrets(func() (secretSource, error) {
+		t.Error("the secret source was created for a plan without sensitive variables")
+		return nil, nil
+	}, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeSecretsFile encrypts the given JSON with a passphrase and returns the file name
+func writeSecretsFile(t *testing.T, passphrase string, armored bool, content string) string {
+	t.Helper()
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(&buf)
+		dst = armorWriter
+	}
+
+	w, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if armorWriter != nil {
+		if err = armorWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "secrets.age")
+	if err = os.WriteFile(filename, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
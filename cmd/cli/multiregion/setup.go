@@ -5,524 +5,1080 @@ Copyright © 2023 SIL International
 package multiregion
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/silinternational/tfc-ops/v3/lib"
 	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
+type setupOptions struct {
+	plan      bool
+	planFile  string
+	applyPlan string
+	resume    bool
+	journal   string
+
+	// setRemoteConsumers is true to add the secondary workspaces as remote state consumers, needed if
+	// workspace-specific remote state sharing is used
+	setRemoteConsumers bool
+
+	// secrets is the source of sensitive variable values, by default selected by the secrets-source setting
+	secrets secretSource
+
+	// zones lists the availability zones of a region, by default using the EC2 API
+	zones ZoneFinder
+}
+
+// secretSource returns the source of sensitive variable values
+func (o setupOptions) secretSource(w io.Writer) (secretSource, error) {
+	if o.secrets != nil {
+		return o.secrets, nil
+	}
+	return newSecretSource(w)
+}
+
 func InitSetupCmd(parentCmd *cobra.Command) {
+	var opts setupOptions
+
 	setupCmd := &cobra.Command{
 		Use:   "setup",
 		Short: "Manage multiregion setup",
-		Long:  `Perform initial setup of a multiregion IdP`,
-		Run: func(cmd *cobra.Command, args []string) {
-			runSetup()
+		Long: `Perform initial setup of a multiregion IdP. The complete set of changes is computed and displayed
+before any change is made. Use --plan to stop after displaying the changes, optionally saving them with --plan-file.
+A saved plan can be applied later with --apply-plan. Progress is recorded in a journal file while changes are made.
+If setup is interrupted, use --resume to skip the completed changes and retry the rest. The workspaces being changed
+are locked until setup finishes. If an interrupted setup leaves them locked, use "idp-cli unlock" before --resume.
+Use --set-remote-consumers if the primary workspaces share their remote state with specific workspaces only.
+
+Sensitive variables in the primary workspaces cannot be copied. Each variable marked sensitive in a primary workspace
+is planned for its secondary workspace, whatever was copied when cloning, and the values are requested before any
+change is made, from the source selected by --secrets-source:
+  prompt - interactive input, not echoed (default), which cannot be used with --non-interactive
+  env    - environment variables named IDP_CLI_SECRET_<WORKSPACE>_<KEY>, upper case with non-alphanumeric
+           characters replaced by underscores
+  file   - the JSON file given by --secrets-file, encrypted with an age passphrase. The passphrase is read from
+           IDP_CLI_SECRETS_PASSPHRASE, or requested interactively unless --non-interactive is used. The file
+           contains an object for each secondary workspace, keyed by workspace name, mapping variable keys to
+           values.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runSetup(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), pFlags, opts)
 		},
 	}
 
 	parentCmd.AddCommand(setupCmd)
+
+	setupCmd.PersistentFlags().BoolVar(&opts.plan, "plan", false,
+		`display the changes needed but do not make them`,
+	)
+	setupCmd.PersistentFlags().StringVar(&opts.planFile, "plan-file", "",
+		`save the plan to a file, implies --plan`,
+	)
+	setupCmd.PersistentFlags().StringVar(&opts.applyPlan, "apply-plan", "",
+		`apply the changes in a plan file saved by --plan-file`,
+	)
+	setupCmd.PersistentFlags().BoolVar(&opts.resume, "resume", false,
+		`resume an interrupted setup from its journal file`,
+	)
+	setupCmd.PersistentFlags().StringVar(&opts.journal, "journal", "",
+		`journal file for recording setup progress, default is "idp-cli-setup-<idp>-<env>.journal.json"`,
+	)
+	setupCmd.PersistentFlags().BoolVar(&opts.setRemoteConsumers, "set-remote-consumers", false,
+		`add remote state consumers, needed if workspace-specific remote state sharing is used`,
+	)
+	flags.NewStringFlag(setupCmd, flags.SecretsSource, "", secretsSourcePrompt,
+		`source of sensitive variable values: prompt, env, or file`)
+	flags.NewStringFlag(setupCmd, flags.SecretsFile, "", "", `encrypted secrets file, for --secrets-source=file`)
 }
 
-func runSetup() {
-	pFlags := getPersistentFlags()
+// SetupPlan is the complete set of changes needed to set up a multiregion IdP
+type SetupPlan struct {
+	Org     string        `json:"org" yaml:"org"`
+	Idp     string        `json:"idp" yaml:"idp"`
+	Env     string        `json:"env" yaml:"env"`
+	Changes []SetupChange `json:"changes" yaml:"changes"`
+}
 
-	if pFlags.readOnlyMode {
-		fmt.Println("-- Read-only mode enabled --")
-	}
+// SetupChange is one change to be made by the setup command
+type SetupChange struct {
+	Workspace string `json:"workspace" yaml:"workspace"`
+	Type      string `json:"type" yaml:"type"`
+	Action    string `json:"action" yaml:"action"`
+	Key       string `json:"key,omitempty" yaml:"key,omitempty"`
+	OldValue  string `json:"old_value,omitempty" yaml:"old_value,omitempty"`
+	NewValue  string `json:"new_value,omitempty" yaml:"new_value,omitempty"`
+	Hcl       bool   `json:"hcl,omitempty" yaml:"hcl,omitempty"`
+
+	// Sensitive is true for a variable whose value is read from a secret source when the change is applied
+	Sensitive bool `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+}
 
-	lib.SetToken(pFlags.tfcToken)
+// SetupChange types
+const (
+	changeTypeWorkspace           = "workspace"
+	changeTypeProperty            = "property"
+	changeTypeVariable            = "variable"
+	changeTypeRemoteStateConsumer = "remote-state-consumer"
+	changeTypeRunTrigger          = "run-trigger"
+	changeTypeDestroyRun          = "destroy-run"
+	changeTypeApplyRun            = "apply-run"
+)
 
-	createSecondaryWorkspaces(pFlags)
-	setMultiregionVariables(pFlags)
-	deleteUnusedVariables(pFlags)
-	setSensitiveVariables(pFlags)
+// SetupChange actions
+const (
+	changeActionCreate = "create"
+	changeActionUpdate = "update"
+	changeActionDelete = "delete"
+)
 
-	answer := simplePrompt(`\nSet remote consumers? Type "yes" if workspace-specific sharing is used.`)
-	if answer == "yes" {
-		if err := setRemoteConsumers(pFlags); err != nil {
-			log.Fatalf("Error: " + err.Error())
+// String returns a one-line description of the change in diff format
+func (c SetupChange) String() string {
+	switch c.Type {
+	case changeTypeWorkspace:
+		if c.Action == changeActionDelete {
+			return fmt.Sprintf("- %s: delete workspace", c.Workspace)
 		}
+		return fmt.Sprintf("+ %s: clone workspace from %s", c.Workspace, c.NewValue)
+	case changeTypeProperty:
+		return fmt.Sprintf("~ %s: %s %q -> %q", c.Workspace, c.Key, c.OldValue, c.NewValue)
+	case changeTypeVariable:
+		if c.Sensitive && c.Action != changeActionDelete {
+			return fmt.Sprintf("+ %s: var.%s = (sensitive)", c.Workspace, c.Key)
+		}
+		switch c.Action {
+		case changeActionCreate:
+			return fmt.Sprintf("+ %s: var.%s = %q", c.Workspace, c.Key, c.NewValue)
+		case changeActionUpdate:
+			return fmt.Sprintf("~ %s: var.%s %q -> %q", c.Workspace, c.Key, c.OldValue, c.NewValue)
+		case changeActionDelete:
+			return fmt.Sprintf("- %s: var.%s (was %q)", c.Workspace, c.Key, c.OldValue)
+		}
+	case changeTypeRemoteStateConsumer:
+		if c.Action == changeActionDelete {
+			return fmt.Sprintf("- %s: remote state consumer %s", c.Workspace, c.Key)
+		}
+		return fmt.Sprintf("+ %s: remote state consumer %s", c.Workspace, c.Key)
+	case changeTypeRunTrigger:
+		if c.Action == changeActionDelete {
+			return fmt.Sprintf("- %s: run trigger from %s", c.Workspace, c.Key)
+		}
+		return fmt.Sprintf("+ %s: run trigger from %s", c.Workspace, c.Key)
+	case changeTypeDestroyRun:
+		return fmt.Sprintf("! %s: destroy all resources", c.Workspace)
+	case changeTypeApplyRun:
+		return fmt.Sprintf("> %s: start a run and wait for it to apply", c.Workspace)
 	}
-
-	err := setRunTriggers(pFlags)
-	if err != nil {
-		log.Fatalf("Error: %s", err)
-	}
+	return fmt.Sprintf("? %s: %s %s %s", c.Workspace, c.Action, c.Type, c.Key)
 }
 
-// createSecondaryWorkspaces creates new secondary workspaces by cloning the corresponding primary workspace
-func createSecondaryWorkspaces(pFlags PersistentFlags) {
-	fmt.Println("\nCreating secondary workspaces...")
+// setup computes the changes needed for a multiregion IdP without making any changes
+type setup struct {
+	ctx    context.Context
+	tfc    TerraformCloud
+	pFlags PersistentFlags
 
-	createSecondaryWorkspace(pFlags, clusterWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, databaseWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, pmaWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, emailWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, brokerWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, pwWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, sspWorkspace(pFlags))
-	createSecondaryWorkspace(pFlags, syncWorkspace(pFlags))
-}
+	// workspaceIDs is a map of workspace names (key) and IDs (value) of all existing workspaces for the IdP
+	workspaceIDs map[string]string
 
-// createSecondaryWorkspace creates a new secondary workspace by cloning the corresponding primary workspace. It also
-// changes workspace properties as necessary.
-func createSecondaryWorkspace(pFlags PersistentFlags, workspace string) {
-	newWorkspace := workspace + "-secondary"
-	wsList := lib.FindWorkspaces(pFlags.org, newWorkspace)
+	// clones is a map of new workspace names (key) and source workspace names (value) for workspaces to be cloned
+	clones map[string]string
 
-	if len(wsList) == 0 && !pFlags.readOnlyMode {
-		cloneWorkspace(pFlags, workspace, newWorkspace)
-	}
+	// variables is a map of workspace names (key) and current variables (value)
+	variables map[string][]lib.Var
 
-	setWorkspaceProperties(pFlags, newWorkspace)
-}
+	// zoneFinder lists the availability zones of the secondary region
+	zoneFinder ZoneFinder
 
-// cloneWorkspace clones a workspace
-func cloneWorkspace(pFlags PersistentFlags, workspace, newWorkspace string) {
-	fmt.Printf("Cloning %s to %s\n", workspace, newWorkspace)
+	// setRemoteConsumers is true to plan the remote state consumers
+	setRemoteConsumers bool
 
-	config := lib.CloneConfig{
-		Organization:      pFlags.org,
-		SourceWorkspace:   workspace,
-		NewWorkspace:      newWorkspace,
-		CopyVariables:     true,
-		ApplyVariableSets: true,
+	changes []SetupChange
+}
+
+func runSetup(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags, opts setupOptions) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
 	}
-	sensitiveVars, err := lib.CloneWorkspace(config)
-	if err != nil {
-		log.Fatalf("Error: failed to clone workspace %s: %s", workspace, err)
-		return
+
+	newSecretSource := func() (secretSource, error) { return opts.secretSource(pFlags.progress) }
+	journalFile := opts.journal
+	if journalFile == "" {
+		journalFile = defaultJournalFile(pFlags)
 	}
 
-	if len(sensitiveVars) > 0 {
-		fmt.Printf("%s - these sensitive variables must be set manually:\n", workspace)
-		for _, v := range sensitiveVars {
-			fmt.Printf("  %s\n", v)
+	if opts.resume {
+		if opts.plan || opts.planFile != "" || opts.applyPlan != "" {
+			return fmt.Errorf("%w: --resume cannot be used with --plan, --plan-file, or --apply-plan", clierr.ErrConfig)
 		}
-	}
-}
 
-// setWorkspaceProperties
-func setWorkspaceProperties(pFlags PersistentFlags, workspace string) {
-	fmt.Printf("Setting %s properties\n", workspace)
+		journal, err := readSetupJournal(pFlags, journalFile)
+		if err != nil {
+			return err
+		}
+		journal.printProgress(pFlags.progress)
+		plan := journal.plan()
+		printPlan(pFlags.progress, plan)
 
-	wsProperties, err := lib.GetWorkspaceData(pFlags.org, workspace)
-	if err != nil {
 		if pFlags.readOnlyMode {
-			// In read-only mode, ignore the error since the workspace creation was skipped. The query is still
-			// useful, though, since the workspace may have been created previously.
-			wsProperties = lib.WorkspaceJSON{}
-		} else {
-			log.Fatalf("Error: failed to get workspace details for %q: %s", workspace, err)
+			output.Print(plan)
+			return nil
 		}
-	}
 
-	// strip the "idp-name-env-" from the front of "idp-name-env-000-workspace-name"
-	newWorkingDir := strings.SplitN(workspace, "-", 4)[3]
+		if journal.secrets, err = readSecrets(newSecretSource, journal.pendingChanges()); err != nil {
+			return err
+		}
+		return applySetupJournal(tfc, pFlags, journal, plan)
+	}
 
-	if wsProperties.Data.Attributes.WorkingDirectory == newWorkingDir {
-		fmt.Printf("%s - working-directory is already set to %s\n", workspace, newWorkingDir)
+	var plan SetupPlan
+	var err error
+	if opts.applyPlan != "" {
+		plan, err = readPlanFile(pFlags, opts.applyPlan)
 	} else {
-		if pFlags.readOnlyMode {
-			return
-		}
-		params := lib.WorkspaceUpdateParams{
-			Organization:    pFlags.org,
-			WorkspaceFilter: workspace,
-			Attribute:       "working-directory",
-			Value:           newWorkingDir,
+		var s *setup
+		if s, err = newSetup(ctx, tfc, pFlags); err != nil {
+			return err
 		}
-		if err = lib.UpdateWorkspace(params); err != nil {
-			log.Fatalf("Error: failed to update workspace %s: %s", workspace, err)
-			return
+		if opts.zones != nil {
+			s.zoneFinder = opts.zones
 		}
+		s.setRemoteConsumers = opts.setRemoteConsumers
+		plan, err = s.makePlan()
+	}
+	if err != nil {
+		return err
 	}
-}
 
-// setMultiregionVariables sets variables in Terraform Cloud as needed for a multiregion IdP
-func setMultiregionVariables(pFlags PersistentFlags) {
-	fmt.Println("\nSetting variables...")
+	printPlan(pFlags.progress, plan)
 
-	tfRemoteClusterSecondary := lib.TFVar{Key: "tf_remote_cluster_secondary", Value: pFlags.org + "/" + clusterSecondaryWorkspace(pFlags)}
-	tfRemoteDatabase := lib.TFVar{Key: "tf_remote_database", Value: pFlags.org + "/" + databaseWorkspace(pFlags)}
-	tfRemoteDatabaseSecondary := lib.TFVar{Key: "tf_remote_database_secondary", Value: pFlags.org + "/" + databaseSecondaryWorkspace(pFlags)}
-	tfRemoteEmailSecondary := lib.TFVar{Key: "tf_remote_email_secondary", Value: pFlags.org + "/" + emailSecondaryWorkspace(pFlags)}
-	tfRemoteBrokerSecondary := lib.TFVar{Key: "tf_remote_broker_secondary", Value: pFlags.org + "/" + brokerSecondaryWorkspace(pFlags)}
-	tfRemotePwManagerSecondary := lib.TFVar{Key: "tf_remote_pwmanager_secondary", Value: pFlags.org + "/" + pwSecondaryWorkspace(pFlags)}
-	tfRemoteSsp := lib.TFVar{Key: "tf_remote_simplesamlphp", Value: pFlags.org + "/" + sspWorkspace(pFlags)}
+	if opts.planFile != "" {
+		if err = writePlanFile(pFlags.progress, plan, opts.planFile); err != nil {
+			return err
+		}
+	}
 
-	// Set variables in primary workspaces that also point to secondary workspaces
+	if pFlags.readOnlyMode || opts.plan || opts.planFile != "" || len(plan.Changes) == 0 {
+		output.Print(plan)
+		return nil
+	}
 
-	coreVars := []lib.TFVar{
-		{Key: "aws_create_secondary", Value: "true"},
-		{Key: "aws_region_secondary", Value: pFlags.secondaryRegion},
+	journal, err := newSetupJournal(plan, journalFile)
+	if err != nil {
+		return err
+	}
+	if journal.secrets, err = readSecrets(newSecretSource, plan.Changes); err != nil {
+		return err
 	}
-	setVars(pFlags, coreWorkspace(pFlags), coreVars)
+	return applySetupJournal(tfc, pFlags, journal, plan)
+}
 
-	backupVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
+// applySetupJournal applies the changes recorded in a journal while the plan workspaces are locked
+func applySetupJournal(tfc TerraformCloud, pFlags PersistentFlags, journal *setupJournal, plan SetupPlan) error {
+	lock, err := lockPlanWorkspaces(tfc, pFlags, plan)
+	if err != nil {
+		return err
 	}
-	setVars(pFlags, backupWorkspace(pFlags), backupVars)
+	defer lock.unlock()
 
-	brokerSearchVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteBrokerSecondary,
+	_, _ = fmt.Fprintln(pFlags.progress, "\nApplying changes...")
+	if err = journal.apply(pFlags.progress, tfc); err != nil {
+		return err
 	}
-	setVars(pFlags, searchWorkspace(pFlags), brokerSearchVars)
 
-	// Set variables in the new secondary workspaces
+	output.Print(plan)
+	return nil
+}
 
-	clusterVars := []lib.TFVar{
-		{Key: "aws_zones", Value: getZonesHCL(pFlags.secondaryRegion), Hcl: true},
+// lockPlanWorkspaces locks the core workspace and each existing workspace changed by a setup plan
+func lockPlanWorkspaces(tfc TerraformCloud, pFlags PersistentFlags, plan SetupPlan) (*workspaceLock, error) {
+	workspaces := []string{workspaceName(pFlags, Core)}
+	for _, c := range plan.Changes {
+		workspaces = append(workspaces, c.Workspace)
 	}
-	setVars(pFlags, clusterSecondaryWorkspace(pFlags), clusterVars)
 
-	databaseVars := []lib.TFVar{
-		{Key: "availability_zone", Value: pFlags.secondaryRegion + "a"}, // TODO: make this work in all regions
-		tfRemoteClusterSecondary,
-		tfRemoteDatabase,
+	return lockWorkspaces(tfc, pFlags, "setup", workspaces)
+}
+
+func newSetup(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags) (*setup, error) {
+	workspaceIDs, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		return nil, err
 	}
-	setVars(pFlags, databaseSecondaryWorkspace(pFlags), databaseVars)
+	return &setup{
+		ctx:          ctx,
+		tfc:          tfc,
+		pFlags:       pFlags,
+		workspaceIDs: workspaceIDs,
+		clones:       map[string]string{},
+		variables:    map[string][]lib.Var{},
+		zoneFinder:   defaultZoneFinder{},
+	}, nil
+}
 
-	pmaVars := []lib.TFVar{
-		{Key: "pma_subdomain", Value: pFlags.idp + "-pma-secondary"},
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
+// makePlan reads the current configuration from Terraform Cloud and returns the changes needed
+func (s *setup) makePlan() (SetupPlan, error) {
+	steps := []func() error{
+		s.planSecondaryWorkspaces,
+		s.planMultiregionVariables,
+		s.planUnusedVariables,
+		s.planSensitiveVariables,
 	}
-	setVars(pFlags, pmaSecondaryWorkspace(pFlags), pmaVars)
+	if s.setRemoteConsumers {
+		steps = append(steps, s.planRemoteConsumers)
+	}
+	steps = append(steps, s.planRunTriggers)
 
-	emailVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return SetupPlan{}, err
+		}
 	}
-	setVars(pFlags, emailSecondaryWorkspace(pFlags), emailVars)
 
-	brokerVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
-		tfRemoteEmailSecondary,
+	return SetupPlan{
+		Org:     s.pFlags.org,
+		Idp:     s.pFlags.idp,
+		Env:     s.pFlags.env,
+		Changes: s.changes,
+	}, nil
+}
+
+// add adds a change to the plan
+func (s *setup) add(change SetupChange) {
+	s.changes = append(s.changes, change)
+}
+
+// exists returns true if a workspace exists or will be created by the plan
+func (s *setup) exists(workspace string) bool {
+	_, exists := s.workspaceIDs[workspace]
+	_, cloned := s.clones[workspace]
+	return exists || cloned
+}
+
+// getVariables returns the current variables of a workspace. For a workspace to be cloned, these are the variables
+// that will be copied from the source workspace.
+func (s *setup) getVariables(workspace string) ([]lib.Var, error) {
+	if source, ok := s.clones[workspace]; ok {
+		workspace = source
+	}
+	if vars, ok := s.variables[workspace]; ok {
+		return vars, nil
 	}
-	setVars(pFlags, brokerSecondaryWorkspace(pFlags), brokerVars)
 
-	pwVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
-		tfRemoteEmailSecondary,
-		tfRemoteBrokerSecondary,
+	vars, err := s.tfc.ListVariables(workspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the variables from %q: %w", workspace, err)
+	}
+	s.variables[workspace] = vars
+	return vars, nil
+}
+
+// checkFailoverInactive returns an error if the secondary cluster is in failover mode
+func (s *setup) checkFailoverInactive() error {
+	workspace := workspaceName(s.pFlags, ClusterSecondary)
+	if _, ok := s.workspaceIDs[workspace]; !ok {
+		return nil
 	}
-	setVars(pFlags, pwSecondaryWorkspace(pFlags), pwVars)
 
-	sspVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteDatabaseSecondary,
-		tfRemoteBrokerSecondary,
-		tfRemotePwManagerSecondary,
-		tfRemoteSsp,
+	vars, err := s.getVariables(workspace)
+	if err != nil {
+		return err
+	}
+	if v := findVar(vars, awsFailoverActive); v != nil && v.Value == "true" {
+		return fmt.Errorf("%w: failover is active in %s, run failback first", clierr.ErrAborted, workspace)
 	}
-	setVars(pFlags, sspSecondaryWorkspace(pFlags), sspVars)
+	return nil
+}
+
+// planSecondaryWorkspaces plans new secondary workspaces by cloning the corresponding primary workspace
+func (s *setup) planSecondaryWorkspaces() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking secondary workspaces...")
 
-	syncVars := []lib.TFVar{
-		tfRemoteClusterSecondary,
-		tfRemoteEmailSecondary,
-		tfRemoteBrokerSecondary,
+	for _, w := range s.pFlags.catalog.workspaces {
+		if w.Secondary == "" {
+			continue
+		}
+		if err := s.planSecondaryWorkspace(workspaceName(s.pFlags, w.Key), workspaceName(s.pFlags, w.Secondary)); err != nil {
+			return err
+		}
 	}
-	setVars(pFlags, syncSecondaryWorkspace(pFlags), syncVars)
+	return nil
 }
 
-func deleteUnusedVariables(pFlags PersistentFlags) {
-	fmt.Println("\nDeleting unused variables...")
+// planSecondaryWorkspace plans a new secondary workspace by cloning the corresponding primary workspace. It also
+// plans changes to the workspace properties as necessary.
+func (s *setup) planSecondaryWorkspace(workspace, newWorkspace string) error {
+	source := newWorkspace
+	if _, ok := s.workspaceIDs[newWorkspace]; !ok {
+		s.add(SetupChange{
+			Workspace: newWorkspace,
+			Type:      changeTypeWorkspace,
+			Action:    changeActionCreate,
+			NewValue:  workspace,
+		})
+		s.clones[newWorkspace] = workspace
+		source = workspace
+	}
+
+	// a cloned workspace has the same properties as its source workspace
+	wsProperties, err := s.tfc.GetWorkspace(source)
+	if err != nil {
+		return err
+	}
 
-	deleteVariablesFromWorkspace(pFlags, databaseSecondaryWorkspace(pFlags), []string{
-		"backup_retention_period",
-		"multi_az",
-		"skip_final_snapshot",
-		"tf_remote_cluster",
-	})
-	deleteVariablesFromWorkspace(pFlags, pmaSecondaryWorkspace(pFlags), []string{
-		"tf_remote_cluster",
-		"tf_remote_database",
-	})
-	deleteVariablesFromWorkspace(pFlags, emailSecondaryWorkspace(pFlags), []string{
-		"aws_region",
-		"tf_remote_cluster",
-		"tf_remote_database",
-	})
-	deleteVariablesFromWorkspace(pFlags, brokerSecondaryWorkspace(pFlags), []string{
-		"aws_region",
-		"tf_remote_cluster",
-		"tf_remote_database",
-		"tf_remote_email",
-	})
-	deleteVariablesFromWorkspace(pFlags, pwSecondaryWorkspace(pFlags), []string{
-		"aws_region",
-		"tf_remote_broker",
-		"tf_remote_cluster",
-		"tf_remote_database",
-		"tf_remote_elasticache",
-		"tf_remote_email",
-	})
-	deleteVariablesFromWorkspace(pFlags, sspSecondaryWorkspace(pFlags), []string{
-		"aws_region",
-		"tf_remote_broker",
-		"tf_remote_cluster",
-		"tf_remote_database",
-		"tf_remote_elasticache",
-		"tf_remote_pwmanager",
-	})
-	deleteVariablesFromWorkspace(pFlags, syncSecondaryWorkspace(pFlags), []string{
-		"aws_region",
-		"tf_remote_broker",
-		"tf_remote_cluster",
-		"tf_remote_email",
+	newWorkingDir, err := workingDirectory(s.pFlags, newWorkspace)
+	if err != nil {
+		return err
+	}
+	currentWorkingDir := wsProperties.Attributes.WorkingDirectory
+	if currentWorkingDir == newWorkingDir {
+		_, _ = fmt.Fprintf(s.pFlags.progress, "%s - working-directory is already set to %s\n", newWorkspace,
+			newWorkingDir)
+		return nil
+	}
+
+	s.add(SetupChange{
+		Workspace: newWorkspace,
+		Type:      changeTypeProperty,
+		Action:    changeActionUpdate,
+		Key:       lib.WsAttrWorkingDirectory,
+		OldValue:  currentWorkingDir,
+		NewValue:  newWorkingDir,
 	})
+	return nil
 }
 
-func deleteVariablesFromWorkspace(pFlags PersistentFlags, workspace string, keysToDelete []string) {
-	currentVars, err := lib.GetVarsFromWorkspace(pFlags.org, workspace)
+// planMultiregionVariables plans variables in Terraform Cloud as needed for a multiregion IdP
+func (s *setup) planMultiregionVariables() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking variables...")
+
+	zones, err := availabilityZones(s.ctx, s.zoneFinder, s.pFlags.secondaryRegion)
 	if err != nil {
-		log.Fatalf("failed to get the variables from %q", workspace)
+		return err
 	}
+	_, _ = fmt.Fprintf(s.pFlags.progress, "Availability zones in %s: %s\n", s.pFlags.secondaryRegion,
+		strings.Join(zones, ", "))
 
-	for _, k := range keysToDelete {
-		v := findVar(currentVars, k)
-		if v == nil {
-			fmt.Printf("variable %s in workspace %s has already been deleted\n", k, workspace)
-			continue
+	for _, w := range getMultiregionVariables(s.pFlags, zones) {
+		currentVars, err := s.getVariables(w.workspace)
+		if err != nil {
+			return err
+		}
+		for _, tfVar := range w.variables {
+			s.planVariable(currentVars, w.workspace, tfVar)
 		}
-		fmt.Printf("deleting %s in workspace %s\n", k, workspace)
-		lib.DeleteVariable(v.ID)
 	}
+	return nil
 }
 
-func setSensitiveVariables(pFlags PersistentFlags) {
-	fmt.Println("\nSetting sensitive variables...")
-	fmt.Println("(This feature is not yet implemented.)")
-	// TODO: prompt for sensitive values or get them from config
+// planVariable plans a variable change using the list of current variables to decide whether to update or create
+func (s *setup) planVariable(vars []lib.Var, workspace string, tfVar lib.TFVar) {
+	v := findVar(vars, tfVar.Key)
+	if v == nil {
+		s.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeVariable,
+			Action:    changeActionCreate,
+			Key:       tfVar.Key,
+			NewValue:  tfVar.Value,
+			Hcl:       tfVar.Hcl,
+		})
+		return
+	}
+
+	if v.Value == tfVar.Value {
+		_, _ = fmt.Fprintf(s.pFlags.progress, "%s - var.%s is already set to %q\n", workspace, tfVar.Key, tfVar.Value)
+		return
+	}
+
+	s.add(SetupChange{
+		Workspace: workspace,
+		Type:      changeTypeVariable,
+		Action:    changeActionUpdate,
+		Key:       tfVar.Key,
+		OldValue:  v.Value,
+		NewValue:  tfVar.Value,
+		Hcl:       tfVar.Hcl,
+	})
 }
 
-// setVars sets a list of variables using the current variable values to decide whether to update or create
-func setVars(pFlags PersistentFlags, workspace string, newVars []lib.TFVar) {
-	currentVars, err := lib.GetVarsFromWorkspace(pFlags.org, workspace)
-	if err != nil {
-		log.Fatalf("failed to get the variables from %q", workspace)
+// planUnusedVariables plans deletion of variables that are not used in the secondary workspaces
+func (s *setup) planUnusedVariables() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking unused variables...")
+
+	for _, w := range getUnusedVariables(s.pFlags) {
+		currentVars, err := s.getVariables(w.workspace)
+		if err != nil {
+			return err
+		}
+		for _, k := range w.keys {
+			v := findVar(currentVars, k)
+			if v == nil {
+				_, _ = fmt.Fprintf(s.pFlags.progress, "variable %s in workspace %s has already been deleted\n", k,
+					w.workspace)
+				continue
+			}
+			s.add(SetupChange{
+				Workspace: w.workspace,
+				Type:      changeTypeVariable,
+				Action:    changeActionDelete,
+				Key:       k,
+				OldValue:  v.Value,
+			})
+		}
 	}
+	return nil
+}
+
+// planSensitiveVariables plans the sensitive variables of each secondary workspace, which are the sensitive variables
+// of the corresponding primary workspace. Sensitive values cannot be read or copied, so a variable is only planned if
+// it is missing or not yet marked sensitive in the secondary workspace.
+func (s *setup) planSensitiveVariables() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking sensitive variables...")
+
+	for _, key := range s.pFlags.catalog.secondaries() {
+		workspace := workspaceName(s.pFlags, key)
+		source := workspaceName(s.pFlags, s.pFlags.catalog.primary(key))
+		if _, ok := s.workspaceIDs[source]; !ok {
+			continue
+		}
+
+		var currentVars []lib.Var
+		if _, cloned := s.clones[workspace]; !cloned {
+			var err error
+			if currentVars, err = s.getVariables(workspace); err != nil {
+				return err
+			}
+		}
+
+		sourceVars, err := s.getVariables(source)
+		if err != nil {
+			return err
+		}
+		for _, sourceVar := range sourceVars {
+			if !sourceVar.Sensitive {
+				continue
+			}
 
-	for _, v := range newVars {
-		setVar(pFlags, currentVars, workspace, v)
+			change := SetupChange{
+				Workspace: workspace,
+				Type:      changeTypeVariable,
+				Action:    changeActionCreate,
+				Key:       sourceVar.Key,
+				Hcl:       sourceVar.Hcl,
+				Sensitive: true,
+			}
+			if v := findVar(currentVars, sourceVar.Key); v != nil {
+				if v.Sensitive {
+					_, _ = fmt.Fprintf(s.pFlags.progress, "%s - sensitive var.%s is already set\n", workspace,
+						sourceVar.Key)
+					continue
+				}
+				change.Action = changeActionUpdate
+			}
+			s.add(change)
+		}
 	}
+	return nil
 }
 
-// setVar sets a variable using the list of current variables to decide whether to update or create
-func setVar(pFlags PersistentFlags, vars []lib.Var, workspace string, tfVar lib.TFVar) {
-	if v := findVar(vars, tfVar.Key); v == nil {
-		fmt.Printf("%s - creating var.%s with value %q\n", workspace, tfVar.Key, tfVar.Value)
-		if !pFlags.readOnlyMode {
-			lib.CreateVariable(pFlags.org, workspace, tfVar)
+// planRemoteConsumers plans the remote state consumers that are not already configured
+func (s *setup) planRemoteConsumers() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking workspace remote consumers ...")
+
+	for _, workspace := range remoteStateWorkspaces(s.pFlags) {
+		var currentConsumerIDs []string
+		if id, ok := s.workspaceIDs[workspace]; ok {
+			var err error
+			currentConsumerIDs, err = s.tfc.ListRemoteStateConsumers(id)
+			if err != nil {
+				return err
+			}
 		}
-	} else {
-		if v.Value == tfVar.Value {
-			fmt.Printf("%s - var.%s is already set to %q\n", workspace, tfVar.Key, tfVar.Value)
-			return
+
+		for _, consumer := range getWorkspaceConsumers(s.pFlags, workspace) {
+			if id, ok := s.workspaceIDs[consumer]; ok && slices.Contains(currentConsumerIDs, id) {
+				_, _ = fmt.Fprintf(s.pFlags.progress, "%s - remote state consumer %s is already set\n", workspace,
+					consumer)
+				continue
+			}
+
+			s.add(SetupChange{
+				Workspace: workspace,
+				Type:      changeTypeRemoteStateConsumer,
+				Action:    changeActionCreate,
+				Key:       consumer,
+			})
 		}
-		fmt.Printf("%s - setting var.%s to %q\n", workspace, tfVar.Key, tfVar.Value)
-		if !pFlags.readOnlyMode {
-			lib.UpdateVariable(pFlags.org, workspace, v.ID, tfVar)
+	}
+	return nil
+}
+
+// planRunTriggers plans the run triggers that are not already configured
+func (s *setup) planRunTriggers() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking workspace run triggers ...")
+
+	for _, trigger := range getRunTriggers(s.pFlags) {
+		workspace, source := trigger.workspace, trigger.source
+
+		workspaceID, workspaceExists := s.workspaceIDs[workspace]
+		sourceID, sourceExists := s.workspaceIDs[source]
+		if workspaceExists && sourceExists {
+			found, err := s.tfc.FindRunTrigger(workspaceID, sourceID)
+			if err != nil {
+				return fmt.Errorf("failed to get run triggers for workspace %s: %w", workspace, err)
+			}
+			if found {
+				_, _ = fmt.Fprintf(s.pFlags.progress, "Run trigger %s -> %s is already set\n", source, workspace)
+				continue
+			}
 		}
+
+		s.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeRunTrigger,
+			Action:    changeActionCreate,
+			Key:       source,
+		})
 	}
+	return nil
 }
 
-// findVar locates a variable by its key
-func findVar(vars []lib.Var, key string) *lib.Var {
-	for _, v := range vars {
-		if v.Key == key {
-			return &v
+// planRunTriggerRemoval plans deletion of the run triggers between secondary workspaces
+func (s *setup) planRunTriggerRemoval() error {
+	_, _ = fmt.Fprintln(s.pFlags.progress, "\nChecking workspace run triggers ...")
+
+	for _, trigger := range getRunTriggers(s.pFlags) {
+		workspace, source := trigger.workspace, trigger.source
+
+		workspaceID, workspaceExists := s.workspaceIDs[workspace]
+		sourceID, sourceExists := s.workspaceIDs[source]
+		if !workspaceExists || !sourceExists {
+			continue
+		}
+
+		found, err := s.tfc.FindRunTrigger(workspaceID, sourceID)
+		if err != nil {
+			return fmt.Errorf("failed to get run triggers for workspace %s: %w", workspace, err)
 		}
+		if !found {
+			_, _ = fmt.Fprintf(s.pFlags.progress, "Run trigger %s -> %s has already been deleted\n", source, workspace)
+			continue
+		}
+
+		s.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeRunTrigger,
+			Action:    changeActionDelete,
+			Key:       source,
+		})
 	}
 	return nil
 }
 
-func getZonesHCL(region string) string {
-	// TODO: call the AWS EC2 API to get the actual list of zones. This list is safe for us-east-1, us-east-2, and us-west-2, at least.
+// planRuns plans a destroy or apply run on each existing workspace, in the order given
+func (s *setup) planRuns(runType string, workspaces []string, message string) {
+	for _, workspace := range workspaces {
+		if _, ok := s.workspaceIDs[workspace]; !ok {
+			continue
+		}
+		action := changeActionCreate
+		if runType == changeTypeDestroyRun {
+			action = changeActionDelete
+		}
+		s.add(SetupChange{
+			Workspace: workspace,
+			Type:      runType,
+			Action:    action,
+			NewValue:  message,
+		})
+	}
+}
 
-	const template = `[
-  "%[1]sa", 
-  "%[1]sb", 
-  "%[1]sc",
-  "%[1]sd",
-]`
-	return fmt.Sprintf(template, region)
+// printPlan prints the list of changes in a diff format
+func printPlan(w io.Writer, plan SetupPlan) {
+	_, _ = fmt.Fprintf(w, "\nSetup plan for IdP %q, environment %q, in organization %q:\n", plan.Idp, plan.Env,
+		plan.Org)
+	if len(plan.Changes) == 0 {
+		_, _ = fmt.Fprintln(w, "  No changes are needed.")
+		return
+	}
+	for _, c := range plan.Changes {
+		_, _ = fmt.Fprintln(w, "  "+c.String())
+	}
+	_, _ = fmt.Fprintf(w, "%d changes\n", len(plan.Changes))
 }
 
-func setRemoteConsumers(pFlags PersistentFlags) error {
-	fmt.Println("\nCreating workspace remote consumers ...")
+// writePlanFile saves a plan to a JSON file
+func writePlanFile(w io.Writer, plan SetupPlan, filename string) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err = os.WriteFile(filename, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+	_, _ = fmt.Fprintf(w, "Plan saved to %s\n", filename)
+	return nil
+}
 
-	workspacesToUpdate := []string{
-		coreWorkspace(pFlags),
-		clusterSecondaryWorkspace(pFlags),
-		databaseWorkspace(pFlags),
-		databaseSecondaryWorkspace(pFlags),
-		ecrWorkspace(pFlags),
-		emailSecondaryWorkspace(pFlags),
-		brokerSecondaryWorkspace(pFlags),
-		pwSecondaryWorkspace(pFlags),
+// readPlanFile loads a plan from a JSON file. The plan must be for the same IdP, environment, and organization as the
+// current configuration.
+func readPlanFile(pFlags PersistentFlags, filename string) (SetupPlan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return SetupPlan{}, fmt.Errorf("%w: failed to read plan file: %w", clierr.ErrConfig, err)
 	}
 
-	for _, workspace := range workspacesToUpdate {
-		workspaceID, err := getWorkspaceID(pFlags.org, workspace)
+	var plan SetupPlan
+	if err = json.Unmarshal(data, &plan); err != nil {
+		return SetupPlan{}, fmt.Errorf("%w: failed to decode plan file %s: %w", clierr.ErrConfig, filename, err)
+	}
+
+	if plan.Org != pFlags.org || plan.Idp != pFlags.idp || plan.Env != pFlags.env {
+		return SetupPlan{}, fmt.Errorf("%w: plan file %s is for IdP %q, environment %q, in organization %q",
+			clierr.ErrConfig, filename, plan.Idp, plan.Env, plan.Org)
+	}
+	return plan, nil
+}
+
+// applyChange makes one change in Terraform Cloud. Changes to existing objects are only made if the object is
+// unchanged since the plan was made.
+func applyChange(w io.Writer, tfc TerraformCloud, c SetupChange) error {
+	_, _ = fmt.Fprintln(w, c.String())
+
+	switch c.Type {
+	case changeTypeWorkspace:
+		exists, err := workspaceExists(tfc, c.Workspace)
 		if err != nil {
-			return fmt.Errorf("setRemoteConsumers: %w", err)
+			return err
+		}
+		switch {
+		case c.Action == changeActionDelete && !exists:
+			_, _ = fmt.Fprintf(w, "%s - workspace has already been deleted\n", c.Workspace)
+		case c.Action == changeActionDelete:
+			return tfc.DeleteWorkspace(c.Workspace)
+		case exists:
+			_, _ = fmt.Fprintf(w, "%s - workspace already exists\n", c.Workspace)
+		default:
+			return cloneWorkspace(w, tfc, c.NewValue, c.Workspace)
 		}
 
-		consumers := getWorkspaceConsumers(pFlags, workspace)
-		consumerIDs := make([]string, len(consumers))
-		for i, consumer := range consumers {
-			data, err := lib.GetWorkspaceData(pFlags.org, consumer)
-			if err != nil {
-				return fmt.Errorf("setRemoteConsumers: %w", err)
-			}
-			consumerIDs[i] = data.Data.ID
+	case changeTypeProperty:
+		if err := tfc.UpdateWorkspace(c.Workspace, c.Key, c.NewValue); err != nil {
+			return fmt.Errorf("failed to update workspace %s: %w", c.Workspace, err)
 		}
 
-		if pFlags.readOnlyMode {
-			fmt.Printf("  %s: %+v\n", workspaceID, consumers)
-			continue
+	case changeTypeVariable:
+		return applyVariableChange(w, tfc, c)
+
+	case changeTypeRemoteStateConsumer:
+		workspaceID, err := getWorkspaceID(tfc, c.Workspace)
+		if err != nil {
+			return err
+		}
+		consumerID, err := getWorkspaceID(tfc, c.Key)
+		if err != nil {
+			return err
+		}
+		if c.Action == changeActionDelete {
+			err = tfc.RemoveRemoteStateConsumers(workspaceID, []string{consumerID})
+		} else {
+			err = tfc.AddRemoteStateConsumers(workspaceID, []string{consumerID})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s remote state consumer %s on %s: %w", c.Action, c.Key, c.Workspace, err)
 		}
 
-		if err := lib.AddRemoteStateConsumers(workspaceID, consumerIDs); err != nil {
-			return fmt.Errorf("setRemoteConsumers: %w", err)
+	case changeTypeRunTrigger:
+		if c.Action == changeActionDelete {
+			if err := deleteRunTrigger(tfc, c.Workspace, c.Key); err != nil {
+				return fmt.Errorf("failed to delete run trigger from %s to %s: %w", c.Key, c.Workspace, err)
+			}
+			return nil
 		}
+		if err := createRunTrigger(w, tfc, c.Workspace, c.Key); err != nil {
+			return fmt.Errorf("failed to set run trigger from %s to %s: %w", c.Key, c.Workspace, err)
+		}
+
+	default:
+		return fmt.Errorf("%w: unrecognized change type %q", clierr.ErrConfig, c.Type)
 	}
 	return nil
 }
 
-func getWorkspaceConsumers(pFlags PersistentFlags, workspace string) []string {
-	consumers := map[string][]string{
-		coreWorkspace(pFlags): {
-			clusterSecondaryWorkspace(pFlags),
-			databaseSecondaryWorkspace(pFlags),
-			pmaSecondaryWorkspace(pFlags),
-			emailSecondaryWorkspace(pFlags),
-			brokerSecondaryWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			sspSecondaryWorkspace(pFlags),
-			syncSecondaryWorkspace(pFlags),
-		},
-		clusterSecondaryWorkspace(pFlags): {
-			databaseSecondaryWorkspace(pFlags),
-			pmaSecondaryWorkspace(pFlags),
-			emailSecondaryWorkspace(pFlags),
-			backupWorkspace(pFlags),
-			brokerSecondaryWorkspace(pFlags),
-			searchWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			sspSecondaryWorkspace(pFlags),
-			syncSecondaryWorkspace(pFlags),
-		},
-		databaseWorkspace(pFlags): {
-			databaseSecondaryWorkspace(pFlags),
-		},
-		databaseSecondaryWorkspace(pFlags): {
-			pmaSecondaryWorkspace(pFlags),
-			emailSecondaryWorkspace(pFlags),
-			backupWorkspace(pFlags),
-			brokerSecondaryWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			sspSecondaryWorkspace(pFlags),
-		},
-		ecrWorkspace(pFlags): {
-			emailSecondaryWorkspace(pFlags),
-			brokerSecondaryWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			sspSecondaryWorkspace(pFlags),
-			syncSecondaryWorkspace(pFlags),
-		},
-		emailSecondaryWorkspace(pFlags): {
-			brokerSecondaryWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			syncSecondaryWorkspace(pFlags),
-		},
-		brokerSecondaryWorkspace(pFlags): {
-			searchWorkspace(pFlags),
-			pwSecondaryWorkspace(pFlags),
-			sspSecondaryWorkspace(pFlags),
-			syncSecondaryWorkspace(pFlags),
-		},
-		pwSecondaryWorkspace(pFlags): {
-			sspSecondaryWorkspace(pFlags),
-		},
-		sspWorkspace(pFlags): {
-			sspSecondaryWorkspace(pFlags),
-		},
+// applyRunOrChange makes one change in Terraform Cloud. For a destroy or apply run, the run is started and the
+// change is not complete until the run is successful or the timeout expires.
+func applyRunOrChange(ctx context.Context, w io.Writer, tfc TerraformCloud, c SetupChange, timeout time.Duration) error {
+	if c.Type != changeTypeDestroyRun && c.Type != changeTypeApplyRun {
+		return applyChange(w, tfc, c)
 	}
-	return consumers[workspace]
-}
+	_, _ = fmt.Fprintln(w, c.String())
 
-func getWorkspaceID(org, workspaceName string) (string, error) {
-	data, err := lib.GetWorkspaceData(org, workspaceName)
+	workspaceID, err := getWorkspaceID(tfc, c.Workspace)
 	if err != nil {
-		return "", fmt.Errorf("failed to get workspace data: %w", err)
+		return err
 	}
-	return data.Data.ID, nil
-}
 
-func setRunTriggers(pFlags PersistentFlags) error {
-	fmt.Println("\nSetting workspace run triggers ...")
+	var run Run
+	if c.Type == changeTypeDestroyRun {
+		run, err = tfc.CreateDestroyRun(workspaceID, c.NewValue)
+	} else {
+		run, err = tfc.CreateRun(workspaceID, c.NewValue)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create a run on workspace %s: %w", c.Workspace, err)
+	}
 
-	// map of workspaces (key) and source workspaces (value) for run triggers to be created
-	runTriggers := map[string]string{
-		databaseSecondaryWorkspace(pFlags): clusterSecondaryWorkspace(pFlags),
-		emailSecondaryWorkspace(pFlags):    databaseSecondaryWorkspace(pFlags),
-		brokerSecondaryWorkspace(pFlags):   emailSecondaryWorkspace(pFlags),
-		pwSecondaryWorkspace(pFlags):       brokerSecondaryWorkspace(pFlags),
-		sspSecondaryWorkspace(pFlags):      pwSecondaryWorkspace(pFlags),
-		syncSecondaryWorkspace(pFlags):     sspSecondaryWorkspace(pFlags),
+	run, err = waitForRun(ctx, w, tfc, c.Workspace, run, time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+	if !run.isSuccessful() {
+		return fmt.Errorf("run %s on %s is %s", run.ID, c.Workspace, run.Status)
+	}
+	return nil
+}
+
+// applyVariableChange creates, updates, or deletes a variable
+func applyVariableChange(w io.Writer, tfc TerraformCloud, c SetupChange) error {
+	vars, err := tfc.ListVariables(c.Workspace)
+	if err != nil {
+		return fmt.Errorf("failed to get the variables from %q: %w", c.Workspace, err)
+	}
+	v := findVar(vars, c.Key)
+	tfVar := lib.TFVar{Key: c.Key, Value: c.NewValue, Hcl: c.Hcl, Sensitive: c.Sensitive}
+
+	// a sensitive variable replaces any non-sensitive variable with the same key, such as a placeholder created
+	// when the workspace was cloned
+	if c.Sensitive && c.Action != changeActionDelete {
+		switch {
+		case c.NewValue == "":
+			return fmt.Errorf("%w: no value was provided for %s var.%s", clierr.ErrConfig, c.Workspace, c.Key)
+		case v == nil:
+			err = tfc.CreateVariable(c.Workspace, tfVar)
+		case v.Sensitive:
+			_, _ = fmt.Fprintf(w, "sensitive variable %s in workspace %s is already set\n", c.Key, c.Workspace)
+		default:
+			err = tfc.UpdateVariable(c.Workspace, v.ID, tfVar)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set %s var.%s: %w", c.Workspace, c.Key, err)
+		}
+		return nil
 	}
 
-	for workspace, source := range runTriggers {
-		if err := createRunTrigger(pFlags, workspace, source); err != nil {
-			return fmt.Errorf("failed to set run trigger from %s to %s: %w", source, workspace, err)
+	switch c.Action {
+	case changeActionCreate:
+		if v != nil && v.Value != c.NewValue {
+			return fmt.Errorf("%s var.%s was created since the plan was made", c.Workspace, c.Key)
+		}
+		if v == nil {
+			err = tfc.CreateVariable(c.Workspace, tfVar)
+		}
+
+	case changeActionUpdate:
+		if v != nil && v.Value == c.NewValue {
+			_, _ = fmt.Fprintf(w, "variable %s in workspace %s is already set\n", c.Key, c.Workspace)
+			return nil
 		}
+		if v == nil || v.Value != c.OldValue {
+			return fmt.Errorf("%s var.%s was changed since the plan was made", c.Workspace, c.Key)
+		}
+		err = tfc.UpdateVariable(c.Workspace, v.ID, tfVar)
+
+	case changeActionDelete:
+		if v == nil {
+			_, _ = fmt.Fprintf(w, "variable %s in workspace %s has already been deleted\n", c.Key, c.Workspace)
+			return nil
+		}
+		err = tfc.DeleteVariable(v.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s %s var.%s: %w", c.Action, c.Workspace, c.Key, err)
+	}
+	return nil
+}
+
+// cloneWorkspace clones a workspace
+func cloneWorkspace(w io.Writer, tfc TerraformCloud, workspace, newWorkspace string) error {
+	_, _ = fmt.Fprintf(w, "Cloning %s to %s\n", workspace, newWorkspace)
+
+	if err := tfc.CloneWorkspace(workspace, newWorkspace); err != nil {
+		return fmt.Errorf("failed to clone workspace %s: %w", workspace, err)
 	}
 	return nil
 }
 
-func createRunTrigger(pFlags PersistentFlags, workspaceName, sourceName string) error {
-	workspaceID, err := getWorkspaceID(pFlags.org, workspaceName)
+// createRunTrigger creates a run trigger if it does not already exist
+func createRunTrigger(w io.Writer, tfc TerraformCloud, workspaceName, sourceName string) error {
+	workspaceID, err := getWorkspaceID(tfc, workspaceName)
 	if err != nil {
 		return fmt.Errorf("failed to get workspace ID for run trigger: %w", err)
 	}
 
-	sourceID, err := getWorkspaceID(pFlags.org, sourceName)
+	sourceID, err := getWorkspaceID(tfc, sourceName)
 	if err != nil {
 		return fmt.Errorf("failed to get source workspace ID for run trigger: %w", err)
 	}
 
-	t, err := lib.FindRunTrigger(lib.FindRunTriggerConfig{
-		WorkspaceID:       workspaceID,
-		SourceWorkspaceID: sourceID,
-	})
+	found, err := tfc.FindRunTrigger(workspaceID, sourceID)
 	if err != nil {
 		return fmt.Errorf("failed to get run triggers for workspace %s: %w", workspaceName, err)
 	}
-	if t != nil {
-		fmt.Printf("Run trigger %s -> %s is already set\n", sourceName, workspaceName)
+	if found {
+		_, _ = fmt.Fprintf(w, "Run trigger %s -> %s is already set\n", sourceName, workspaceName)
 		return nil
 	}
 
-	if pFlags.readOnlyMode {
-		fmt.Printf("(Read-only Mode) Run trigger %s -> %s would be set\n", sourceName, workspaceName)
-		return nil
+	if err := tfc.CreateRunTrigger(workspaceID, sourceID); err != nil {
+		return fmt.Errorf("create run trigger API error: %w", err)
 	}
+	return nil
+}
 
-	if err := lib.CreateRunTrigger(lib.RunTriggerConfig{
-		WorkspaceID:       workspaceID,
-		SourceWorkspaceID: sourceID,
-	}); err != nil {
-		return fmt.Errorf("create run trigger API error: %w", err)
+// deleteRunTrigger deletes a run trigger
+func deleteRunTrigger(tfc TerraformCloud, workspaceName, sourceName string) error {
+	workspaceID, err := getWorkspaceID(tfc, workspaceName)
+	if err != nil {
+		return fmt.Errorf("failed to get workspace ID for run trigger: %w", err)
+	}
+
+	sourceID, err := getWorkspaceID(tfc, sourceName)
+	if err != nil {
+		return fmt.Errorf("failed to get source workspace ID for run trigger: %w", err)
+	}
+
+	return tfc.DeleteRunTrigger(workspaceID, sourceID)
+}
+
+// workspaceVariables is a list of variables for one workspace
+type workspaceVariables struct {
+	workspace string
+	variables []lib.TFVar
+}
+
+// workspaceVariableKeys is a list of variable keys for one workspace
+type workspaceVariableKeys struct {
+	workspace string
+	keys      []string
+}
+
+// getMultiregionVariables returns the variables needed for a multiregion IdP, grouped by workspace in catalog order.
+// The availability zones of the secondary region are only needed for the zone variables of the secondary cluster and
+// database.
+func getMultiregionVariables(pFlags PersistentFlags, zones []string) []workspaceVariables {
+	availabilityZone := ""
+	if len(zones) > 0 {
+		availabilityZone = zones[0]
+	}
+
+	// variables that are not remote state references, by the catalog key of the workspace they are set in
+	roleVariables := map[string][]lib.TFVar{
+		Core: {
+			{Key: "aws_create_secondary", Value: "true"},
+			{Key: "aws_region_secondary", Value: pFlags.secondaryRegion},
+		},
+		ClusterSecondary: {
+			{Key: "aws_zones", Value: getZonesHCL(zones), Hcl: true},
+		},
+		DatabaseSecondary: {
+			{Key: "availability_zone", Value: availabilityZone},
+		},
+		PhpmyadminSecondary: {
+			{Key: "pma_subdomain", Value: pFlags.idp + "-pma-secondary"},
+		},
+	}
+
+	var variables []workspaceVariables
+	for _, w := range pFlags.catalog.workspaces {
+		vars := slices.Clone(roleVariables[w.Key])
+		for _, name := range sortedKeys(w.RemoteState) {
+			vars = append(vars, lib.TFVar{Key: name, Value: pFlags.org + "/" + workspaceName(pFlags, w.RemoteState[name])})
+		}
+		if len(vars) > 0 {
+			variables = append(variables, workspaceVariables{workspace: workspaceName(pFlags, w.Key), variables: vars})
+		}
+	}
+	return variables
+}
+
+// getUnusedVariables returns the variables copied from the primary workspaces that are not used in the secondary
+// workspaces, grouped by workspace
+func getUnusedVariables(pFlags PersistentFlags) []workspaceVariableKeys {
+	var unused []workspaceVariableKeys
+	for _, w := range pFlags.catalog.workspaces {
+		if len(w.UnusedVariables) > 0 {
+			unused = append(unused, workspaceVariableKeys{workspace: workspaceName(pFlags, w.Key), keys: w.UnusedVariables})
+		}
+	}
+	return unused
+}
+
+// findVar locates a variable by its key
+func findVar(vars []lib.Var, key string) *lib.Var {
+	for _, v := range vars {
+		if v.Key == key {
+			return &v
+		}
 	}
 	return nil
 }
+
+// remoteStateWorkspaces returns the workspaces that need remote state consumers for a multiregion IdP
+func remoteStateWorkspaces(pFlags PersistentFlags) []string {
+	var workspaces []string
+	for _, w := range pFlags.catalog.workspaces {
+		if len(w.Consumers) > 0 {
+			workspaces = append(workspaces, workspaceName(pFlags, w.Key))
+		}
+	}
+	return workspaces
+}
+
+// getWorkspaceConsumers returns the names of the remote state consumers of a workspace
+func getWorkspaceConsumers(pFlags PersistentFlags, workspace string) []string {
+	var consumers []string
+	for _, w := range pFlags.catalog.workspaces {
+		if workspaceName(pFlags, w.Key) != workspace {
+			continue
+		}
+		for _, consumer := range w.Consumers {
+			consumers = append(consumers, workspaceName(pFlags, consumer))
+		}
+	}
+	return consumers
+}
+
+// runTrigger is a run trigger that starts a run on a workspace after a successful apply of the source workspace
+type runTrigger struct {
+	workspace string
+	source    string
+}
+
+// getRunTriggers returns the run triggers of a multiregion IdP in catalog order
+func getRunTriggers(pFlags PersistentFlags) []runTrigger {
+	var triggers []runTrigger
+	for _, w := range pFlags.catalog.workspaces {
+		for _, source := range w.TriggerSources {
+			triggers = append(triggers, runTrigger{
+				workspace: workspaceName(pFlags, w.Key),
+				source:    workspaceName(pFlags, source),
+			})
+		}
+	}
+	return triggers
+}
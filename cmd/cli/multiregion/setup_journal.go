@@ -0,0 +1,180 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// Journal step status values
+const (
+	journalStatusPending   = "pending"
+	journalStatusStarted   = "started"
+	journalStatusCompleted = "completed"
+)
+
+// setupJournal records the progress of applying a setup plan, so an interrupted setup can be resumed. The journal
+// is saved to a local file before and after each change.
+type setupJournal struct {
+	Org       string        `json:"org"`
+	Idp       string        `json:"idp"`
+	Env       string        `json:"env"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Steps     []journalStep `json:"steps"`
+
+	filename string
+
+	// secrets holds the values of the sensitive variables, keyed by secretKey. They are never saved in the journal.
+	secrets map[string]string
+}
+
+type journalStep struct {
+	Change SetupChange `json:"change"`
+	Status string      `json:"status"`
+}
+
+// defaultJournalFile returns the name of the journal file used if none is specified
+func defaultJournalFile(pFlags PersistentFlags) string {
+	return fmt.Sprintf("idp-cli-setup-%s-%s.journal.json", pFlags.idp, pFlags.env)
+}
+
+// newSetupJournal creates a journal for a plan. An existing journal is not overwritten, since it indicates that a
+// previous setup did not finish.
+func newSetupJournal(plan SetupPlan, filename string) (*setupJournal, error) {
+	if _, err := os.Stat(filename); err == nil {
+		return nil, fmt.Errorf("%w: journal file %s exists, a previous setup did not finish. Use --resume to "+
+			"continue it, or delete the file to start over.", clierr.ErrAborted, filename)
+	}
+
+	j := &setupJournal{
+		Org:      plan.Org,
+		Idp:      plan.Idp,
+		Env:      plan.Env,
+		filename: filename,
+	}
+	for _, c := range plan.Changes {
+		j.Steps = append(j.Steps, journalStep{Change: c, Status: journalStatusPending})
+	}
+	return j, nil
+}
+
+// readSetupJournal loads a journal saved by an earlier setup. The journal must be for the same IdP, environment,
+// and organization as the current configuration.
+func readSetupJournal(pFlags PersistentFlags, filename string) (*setupJournal, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: journal file %s does not exist, there is no setup to resume", clierr.ErrNotFound,
+			filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal file: %w", err)
+	}
+
+	j := &setupJournal{filename: filename}
+	if err = json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode journal file %s: %w", clierr.ErrConfig, filename, err)
+	}
+
+	if j.Org != pFlags.org || j.Idp != pFlags.idp || j.Env != pFlags.env {
+		return nil, fmt.Errorf("%w: journal file %s is for IdP %q, environment %q, in organization %q",
+			clierr.ErrConfig, filename, j.Idp, j.Env, j.Org)
+	}
+	return j, nil
+}
+
+// plan returns the plan recorded in the journal
+func (j *setupJournal) plan() SetupPlan {
+	plan := SetupPlan{Org: j.Org, Idp: j.Idp, Env: j.Env}
+	for _, s := range j.Steps {
+		plan.Changes = append(plan.Changes, s.Change)
+	}
+	return plan
+}
+
+// apply makes each change that is not already completed, saving the journal before and after each change. A change
+// that was started but not completed is retried. The journal file is removed once all changes are completed. If a
+// change fails, the journal is kept so the setup can be resumed.
+func (j *setupJournal) apply(w io.Writer, tfc TerraformCloud) error {
+	for i := range j.Steps {
+		s := &j.Steps[i]
+		if s.Status == journalStatusCompleted {
+			_, _ = fmt.Fprintf(w, "%s (already completed)\n", s.Change)
+			continue
+		}
+
+		s.Status = journalStatusStarted
+		if err := j.save(); err != nil {
+			return err
+		}
+
+		c := s.Change
+		if c.Sensitive {
+			c.NewValue = j.secrets[secretKey(c.Workspace, c.Key)]
+		}
+		if err := applyChange(w, tfc, c); err != nil {
+			return fmt.Errorf("%w\nUse --resume to retry the remaining changes.", err)
+		}
+
+		s.Status = journalStatusCompleted
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+
+	// the journal is never saved if there are no changes
+	if err := os.Remove(j.filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal file: %w", err)
+	}
+	return nil
+}
+
+// save writes the journal file, replacing the previous version
+func (j *setupJournal) save() error {
+	j.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	// write to a temporary file and rename it so an interruption cannot leave a partial journal
+	tmp := j.filename + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write journal file: %w", err)
+	}
+	if err = os.Rename(tmp, j.filename); err != nil {
+		return fmt.Errorf("failed to write journal file: %w", err)
+	}
+	return nil
+}
+
+// pendingChanges returns the changes that are not completed
+func (j *setupJournal) pendingChanges() []SetupChange {
+	var changes []SetupChange
+	for _, s := range j.Steps {
+		if s.Status != journalStatusCompleted {
+			changes = append(changes, s.Change)
+		}
+	}
+	return changes
+}
+
+// printProgress prints the number of changes completed
+func (j *setupJournal) printProgress(w io.Writer) {
+	completed := 0
+	for _, s := range j.Steps {
+		if s.Status == journalStatusCompleted {
+			completed++
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Resuming setup from %s, last updated %s: %d of %d changes completed\n", j.filename,
+		j.UpdatedAt.Local().Format(time.DateTime), completed, len(j.Steps))
+}
@@ -0,0 +1,235 @@
+package multiregion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSetup(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	for _, workspace := range secondaryWorkspaces(pFlags) {
+		w, err := tfc.GetWorkspace(workspace)
+		if err != nil {
+			t.Fatalf("secondary workspace was not created: %s", err)
+		}
+		if want, _ := workingDirectory(pFlags, workspace); w.Attributes.WorkingDirectory != want {
+			got := w.Attributes.WorkingDirectory
+			t.Errorf("%s working directory = %q, want %q", workspace, got, want)
+		}
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, Core), "aws_region_secondary"); got != pFlags.secondaryRegion {
+		t.Errorf("aws_region_secondary = %q, want %q", got, pFlags.secondaryRegion)
+	}
+	if _, ok := tfc.variable(workspaceName(pFlags, IdBrokerSecondary), "tf_remote_email"); ok {
+		t.Error("unused variable tf_remote_email was not deleted")
+	}
+	dbPassword := findVar(tfc.workspaces[workspaceName(pFlags, IdBrokerSecondary)].variables, "db_password")
+	if dbPassword == nil || !dbPassword.Sensitive || dbPassword.Value != "secondary-db-password" {
+		t.Errorf("sensitive variable db_password was not set from the secret source: %+v", dbPassword)
+	}
+
+	checks, err := runAudit(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range checks {
+		if !c.Passed {
+			t.Errorf("audit failed after setup: %s - %s (%s)", c.Workspace, c.Check, c.Detail)
+		}
+	}
+}
+
+func TestRunSetupIsIdempotent(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	plan, err := newTestSetup(t, tfc, pFlags).makePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes after setup, got %d, first: %s", len(plan.Changes), plan.Changes[0])
+	}
+
+	// running setup again changes nothing and does not lock any workspace
+	mutations, locked := tfc.mutations, len(tfc.locked)
+	err = runSetup(context.Background(), tfc, pFlags, setupOptions{
+		journal:            filepath.Join(t.TempDir(), "journal.json"),
+		secrets:            testSecrets(pFlags),
+		zones:              testZones,
+		setRemoteConsumers: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tfc.mutations != mutations || len(tfc.locked) != locked {
+		t.Errorf("second setup made %d changes and %d locks", tfc.mutations-mutations, len(tfc.locked)-locked)
+	}
+}
+
+func TestRunSetupPlan(t *testing.T) {
+	pFlags := testFlags()
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+
+	tfc := newTestIdp(pFlags)
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{plan: true, planFile: planFile, zones: testZones}); err != nil {
+		t.Fatal(err)
+	}
+	if tfc.mutations != 0 {
+		t.Fatalf("plan made %d changes", tfc.mutations)
+	}
+
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{
+		applyPlan: planFile,
+		journal:   filepath.Join(t.TempDir(), "journal.json"),
+		secrets:   testSecrets(pFlags),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tfc.GetWorkspace(workspaceName(pFlags, ClusterSecondary)); err != nil {
+		t.Fatalf("saved plan was not applied: %s", err)
+	}
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), "aws_zones"); got != getZonesHCL(testZones[pFlags.secondaryRegion]) {
+		t.Errorf("aws_zones = %q", got)
+	}
+}
+
+func TestRunSetupReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.readOnlyMode = true
+
+	tfc := newTestIdp(pFlags)
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{zones: testZones, setRemoteConsumers: true}); err != nil {
+		t.Fatal(err)
+	}
+	if tfc.mutations != 0 {
+		t.Fatalf("read-only mode made %d changes", tfc.mutations)
+	}
+}
+
+func TestApplyVariableChange(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestIdp(pFlags)
+	workspace := workspaceName(pFlags, Core)
+
+	err := applyVariableChange(os.Stdout, tfc, SetupChange{
+		Workspace: workspace,
+		Type:      changeTypeVariable,
+		Action:    changeActionUpdate,
+		Key:       "aws_region",
+		OldValue:  pFlags.region,
+		NewValue:  "us-east-2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := tfc.variable(workspace, "aws_region"); got != "us-east-2" {
+		t.Errorf("aws_region = %q, want us-east-2", got)
+	}
+
+	err = applyVariableChange(os.Stdout, tfc, SetupChange{
+		Workspace: workspace,
+		Type:      changeTypeVariable,
+		Action:    changeActionDelete,
+		Key:       "aws_region",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tfc.variable(workspace, "aws_region"); ok {
+		t.Error("aws_region was not deleted")
+	}
+
+	err = applyVariableChange(os.Stdout, tfc, SetupChange{
+		Workspace: workspace,
+		Type:      changeTypeVariable,
+		Action:    changeActionCreate,
+		Key:       "aws_region",
+		NewValue:  "us-west-2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := tfc.variable(workspace, "aws_region"); got != "us-west-2" {
+		t.Errorf("aws_region = %q, want us-west-2", got)
+	}
+}
+
+func TestRunSetupResume(t *testing.T) {
+	pFlags := testFlags()
+	journalFile := filepath.Join(t.TempDir(), "journal.json")
+
+	tfc := newTestIdp(pFlags)
+	s := newTestSetup(t, tfc, pFlags)
+	s.setRemoteConsumers = true
+	plan, err := s.makePlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a setup that stopped after starting the third change
+	journal, err := newSetupJournal(plan, journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = applyChange(os.Stdout, tfc, plan.Changes[i]); err != nil {
+			t.Fatal(err)
+		}
+		journal.Steps[i].Status = journalStatusCompleted
+	}
+	journal.Steps[2].Status = journalStatusStarted
+	if err = journal.save(); err != nil {
+		t.Fatal(err)
+	}
+	mutations := tfc.mutations
+
+	if err := runSetup(context.Background(), tfc, pFlags, setupOptions{resume: true, journal: journalFile, secrets: testSecrets(pFlags)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := tfc.mutations-mutations, len(plan.Changes)-2; got != want {
+		t.Errorf("resume made %d changes, want %d", got, want)
+	}
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Errorf("journal file was not removed after setup completed")
+	}
+	checks, err := runAudit(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range checks {
+		if !c.Passed {
+			t.Errorf("audit failed after resume: %s - %s (%s)", c.Workspace, c.Check, c.Detail)
+		}
+	}
+}
+
+func TestSetupJournal(t *testing.T) {
+	pFlags := testFlags()
+	journalFile := filepath.Join(t.TempDir(), "journal.json")
+	plan := SetupPlan{Org: pFlags.org, Idp: pFlags.idp, Env: pFlags.env, Changes: []SetupChange{
+		{Workspace: workspaceName(pFlags, Core), Type: changeTypeVariable, Action: changeActionCreate, Key: "a", NewValue: "1"},
+	}}
+
+	journal, err := newSetupJournal(plan, journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = journal.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := readSetupJournal(pFlags, journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Steps) != 1 || j.Steps[0].Status != journalStatusPending || j.Steps[0].Change != plan.Changes[0] {
+		t.Errorf("journal was not saved correctly: %+v", j.Steps)
+	}
+}
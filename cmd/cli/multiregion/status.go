@@ -6,59 +6,148 @@ package multiregion
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/silinternational/tfc-ops/v3/lib"
 	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
+// IdpStatus is the multiregion status of one IdP environment
+type IdpStatus struct {
+	Env              string       `json:"env" yaml:"env"`
+	PrimaryRegion    string       `json:"primary_region" yaml:"primary_region"`
+	SecondaryRegion  string       `json:"secondary_region" yaml:"secondary_region"`
+	FailoverActive   bool         `json:"failover_active" yaml:"failover_active"`
+	SecondaryCreated bool         `json:"secondary_created" yaml:"secondary_created"`
+	Audit            []AuditCheck `json:"audit" yaml:"audit"`
+}
+
 func InitStatusCmd(parentCmd *cobra.Command) {
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Read the current status of the IdP",
-		Long:  `Read the current status of the IdP. Does not modify any infrastructure.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			runStatus()
+		Long: `Read the current status of the IdP. Does not modify any infrastructure. Multiple environments can be
+given as a comma-separated list, e.g. "--env prod,stg", to compare them side by side.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runStatus(newTerraformCloud(cmd.Context(), pFlags), pFlags)
 		},
 	}
 
 	parentCmd.AddCommand(statusCmd)
 }
 
-func runStatus() {
-	pFlags := getPersistentFlags()
+func runStatus(tfc TerraformCloud, pFlags PersistentFlags) error {
+	envs, err := parseEnvs(pFlags.env)
+	if err != nil {
+		return err
+	}
+
+	envStatus, err := mapConcurrently(envs, func(env string) (IdpStatus, error) {
+		envFlags := pFlags
+		envFlags.env = env
+		return getStatus(tfc, envFlags)
+	})
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]IdpStatus, len(envs))
+	for i, env := range envs {
+		statuses[i] = envStatus[env]
+	}
+	printStatus(pFlags.progress, statuses)
+
+	for i := range statuses {
+		envFlags := pFlags
+		envFlags.env = statuses[i].Env
+		_, _ = fmt.Fprintf(pFlags.progress, "\nChecking multiregion configuration for %s...\n", envFlags.env)
+		if statuses[i].Audit, err = runAudit(tfc, envFlags); err != nil {
+			return err
+		}
+	}
+
+	output.Print(statuses)
+	return nil
+}
 
-	lib.SetToken(pFlags.tfcToken)
+// parseEnvs splits a comma-separated list of environments, ignoring duplicates
+func parseEnvs(value string) ([]string, error) {
+	var envs []string
+	for _, env := range strings.Split(value, ",") {
+		env = strings.TrimSpace(env)
+		if env == "" {
+			return nil, fmt.Errorf("%w: empty environment name in %q", clierr.ErrConfig, value)
+		}
+		if !slices.Contains(envs, env) {
+			envs = append(envs, env)
+		}
+	}
+	return envs, nil
+}
 
-	workspaceName := fmt.Sprintf("idp-%s-prod-000-core", pFlags.idp)
-	vars, err := lib.GetVarsFromWorkspace(pFlags.org, workspaceName)
+// getStatus reads the multiregion status of the IdP from the core workspace variables
+func getStatus(tfc TerraformCloud, pFlags PersistentFlags) (IdpStatus, error) {
+	workspaceName := workspaceName(pFlags, Core)
+	vars, err := tfc.ListVariables(workspaceName)
 	if err != nil {
-		log.Fatalf("failed to get the variables from %q", workspaceName)
+		return IdpStatus{}, fmt.Errorf("failed to get the variables from %q: %w", workspaceName, err)
 	}
 
+	status := IdpStatus{Env: pFlags.env}
 	for _, v := range vars {
 		switch v.Key {
 		case "aws_region":
-			fmt.Println("Primary region: ", v.Value)
+			status.PrimaryRegion = v.Value
 
 		case "aws_region_secondary":
-			fmt.Println("Secondary region: ", v.Value)
+			status.SecondaryRegion = v.Value
 
 		case "aws_failover_active":
-			if v.Value == "true" {
-				fmt.Println("IdP Failover is ACTIVE")
-			} else {
-				fmt.Println("IdP Failover is NOT active")
-			}
+			status.FailoverActive = v.Value == "true"
 
 		case "aws_create_secondary":
-			if v.Value == "true" {
-				fmt.Println("Secondary resources are CREATED")
-			} else {
-				fmt.Println("Secondary resources are NOT created")
-			}
+			status.SecondaryCreated = v.Value == "true"
 		}
 	}
+	return status, nil
+}
+
+// printStatus prints a table with one column per environment
+func printStatus(out io.Writer, statuses []IdpStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	row := func(label string, value func(s IdpStatus) string) {
+		_, _ = fmt.Fprint(w, label)
+		for _, s := range statuses {
+			_, _ = fmt.Fprint(w, "\t"+value(s))
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	row("Environment:", func(s IdpStatus) string { return s.Env })
+	row("Primary region:", func(s IdpStatus) string { return s.PrimaryRegion })
+	row("Secondary region:", func(s IdpStatus) string { return s.SecondaryRegion })
+	row("IdP Failover:", func(s IdpStatus) string {
+		if s.FailoverActive {
+			return "ACTIVE"
+		}
+		return "NOT active"
+	})
+	row("Secondary resources:", func(s IdpStatus) string {
+		if s.SecondaryCreated {
+			return "CREATED"
+		}
+		return "NOT created"
+	})
 
-	// TODO: check all workspaces for necessary configuration, sort of an audit of the setup command
+	_ = w.Flush()
 }
@@ -0,0 +1,74 @@
+package multiregion
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+func TestGetStatus(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	got, err := getStatus(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IdpStatus{
+		Env:              pFlags.env,
+		PrimaryRegion:    pFlags.region,
+		SecondaryRegion:  pFlags.secondaryRegion,
+		SecondaryCreated: true,
+	}
+	if got.Env != want.Env || got.PrimaryRegion != want.PrimaryRegion || got.SecondaryRegion != want.SecondaryRegion ||
+		got.FailoverActive != want.FailoverActive || got.SecondaryCreated != want.SecondaryCreated {
+		t.Errorf("getStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	stgFlags := pFlags
+	stgFlags.env = "stg"
+	addTestIdp(tfc, stgFlags)
+
+	pFlags.env = "prod, stg"
+	if err := runStatus(tfc, pFlags); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseEnvs(t *testing.T) {
+	envs, err := parseEnvs(" prod,stg , prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"prod", "stg"}; !slices.Equal(envs, want) {
+		t.Errorf("parseEnvs() = %q, want %q", envs, want)
+	}
+
+	for _, value := range []string{"", "prod,", "prod, ,stg"} {
+		if _, err = parseEnvs(value); !errors.Is(err, clierr.ErrConfig) {
+			t.Errorf("parseEnvs(%q) error = %v, want a configuration error", value, err)
+		}
+	}
+}
+
+func TestAuditBeforeSetup(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestIdp(pFlags)
+
+	checks, err := runAudit(tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range checks {
+		if c.Passed {
+			t.Errorf("audit passed before setup: %s - %s", c.Workspace, c.Check)
+		}
+	}
+}
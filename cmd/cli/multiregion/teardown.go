@@ -0,0 +1,250 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+type teardownOptions struct {
+	destroy bool
+	timeout time.Duration
+}
+
+func InitTeardownCmd(parentCmd *cobra.Command) {
+	var opts teardownOptions
+
+	teardownCmd := &cobra.Command{
+		Use:   "teardown",
+		Short: "Remove multiregion setup",
+		Long: `Reverse the multiregion setup of an IdP. Run triggers, remote state consumers, and the variables that
+refer to the secondary workspaces are removed, the core workspace is reverted to a single region, and the secondary
+workspaces are deleted. Workspaces that still manage resources cannot be deleted, so use --destroy to first queue
+destroy runs on the secondary workspaces. Teardown is refused while failover is active.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := getPersistentFlags()
+			if err != nil {
+				return err
+			}
+			return runTeardown(cmd.Context(), newTerraformCloud(cmd.Context(), pFlags), pFlags, opts)
+		},
+	}
+
+	parentCmd.AddCommand(teardownCmd)
+
+	teardownCmd.PersistentFlags().BoolVar(&opts.destroy, "destroy", false,
+		`destroy the resources managed by the secondary workspaces before deleting them`,
+	)
+	teardownCmd.PersistentFlags().DurationVar(&opts.timeout, "timeout", defaultRunTimeout,
+		`maximum time to wait for each destroy run to finish`,
+	)
+}
+
+// teardown computes the changes needed to remove the multiregion setup of an IdP
+type teardown struct {
+	*setup
+}
+
+func runTeardown(ctx context.Context, tfc TerraformCloud, pFlags PersistentFlags, opts teardownOptions) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
+	}
+
+	s, err := newSetup(ctx, tfc, pFlags)
+	if err != nil {
+		return err
+	}
+	t := teardown{setup: s}
+	if err = t.checkFailoverInactive(); err != nil {
+		return err
+	}
+	plan, err := t.makePlan(opts.destroy)
+	if err != nil {
+		return err
+	}
+
+	printPlan(pFlags.progress, plan)
+
+	if pFlags.readOnlyMode || len(plan.Changes) == 0 {
+		output.Print(plan)
+		return nil
+	}
+
+	if !confirmDestructive(pFlags, "Please confirm teardown of the multiregion setup.") {
+		return clierr.ErrAborted
+	}
+
+	_, _ = fmt.Fprintln(pFlags.progress, "\nApplying changes...")
+	for _, c := range plan.Changes {
+		if err = applyRunOrChange(ctx, pFlags.progress, tfc, c, opts.timeout); err != nil {
+			return err
+		}
+	}
+
+	output.Print(plan)
+	return nil
+}
+
+// makePlan reads the current configuration from Terraform Cloud and returns the changes needed. Run triggers are
+// removed before any destroy run so that destroying one workspace does not start runs on the others.
+func (t *teardown) makePlan(destroy bool) (SetupPlan, error) {
+	if err := t.planRemoteVariables(); err != nil {
+		return SetupPlan{}, err
+	}
+	if err := t.planRunTriggerRemoval(); err != nil {
+		return SetupPlan{}, err
+	}
+	if destroy {
+		_, _ = fmt.Fprintln(t.pFlags.progress, "\nChecking destroy runs...")
+		destroyOrder := slices.Clone(secondaryWorkspaceOrder(t.pFlags))
+		slices.Reverse(destroyOrder)
+		t.planRuns(changeTypeDestroyRun, destroyOrder, "multiregion teardown")
+	}
+	if err := t.planRemoteConsumers(); err != nil {
+		return SetupPlan{}, err
+	}
+	t.planWorkspaces()
+	if err := t.planCoreVariables(); err != nil {
+		return SetupPlan{}, err
+	}
+
+	return SetupPlan{
+		Org:     t.pFlags.org,
+		Idp:     t.pFlags.idp,
+		Env:     t.pFlags.env,
+		Changes: t.changes,
+	}, nil
+}
+
+// planRemoteVariables plans deletion of the variables in primary workspaces that refer to secondary workspaces
+func (t *teardown) planRemoteVariables() error {
+	_, _ = fmt.Fprintln(t.pFlags.progress, "\nChecking remote state variables...")
+
+	c := t.pFlags.catalog
+	for _, w := range c.workspaces {
+		workspace := workspaceName(t.pFlags, w.Key)
+		if c.isSecondary(w.Key) {
+			continue
+		}
+		if _, ok := t.workspaceIDs[workspace]; !ok {
+			continue
+		}
+
+		currentVars, err := t.getVariables(workspace)
+		if err != nil {
+			return err
+		}
+		for _, key := range sortedKeys(w.RemoteState) {
+			if !c.isSecondary(w.RemoteState[key]) {
+				continue
+			}
+			v := findVar(currentVars, key)
+			if v == nil {
+				_, _ = fmt.Fprintf(t.pFlags.progress, "%s - var.%s has already been deleted\n", workspace, key)
+				continue
+			}
+			t.add(SetupChange{
+				Workspace: workspace,
+				Type:      changeTypeVariable,
+				Action:    changeActionDelete,
+				Key:       key,
+				OldValue:  v.Value,
+			})
+		}
+	}
+	return nil
+}
+
+// planRemoteConsumers plans removal of the secondary workspaces from the remote state consumers of primary workspaces
+func (t *teardown) planRemoteConsumers() error {
+	_, _ = fmt.Fprintln(t.pFlags.progress, "\nChecking workspace remote consumers ...")
+
+	secondaries := secondaryWorkspaceOrder(t.pFlags)
+	for _, workspace := range remoteStateWorkspaces(t.pFlags) {
+		id, ok := t.workspaceIDs[workspace]
+		if !ok || slices.Contains(secondaries, workspace) {
+			continue
+		}
+
+		currentConsumerIDs, err := t.tfc.ListRemoteStateConsumers(id)
+		if err != nil {
+			return err
+		}
+
+		for _, consumer := range secondaries {
+			if consumerID, ok := t.workspaceIDs[consumer]; !ok || !slices.Contains(currentConsumerIDs, consumerID) {
+				continue
+			}
+			t.add(SetupChange{
+				Workspace: workspace,
+				Type:      changeTypeRemoteStateConsumer,
+				Action:    changeActionDelete,
+				Key:       consumer,
+			})
+		}
+	}
+	return nil
+}
+
+// planWorkspaces plans deletion of the secondary workspaces, dependent workspaces first
+func (t *teardown) planWorkspaces() {
+	_, _ = fmt.Fprintln(t.pFlags.progress, "\nChecking secondary workspaces...")
+
+	for _, workspace := range slices.Backward(secondaryWorkspaceOrder(t.pFlags)) {
+		if _, ok := t.workspaceIDs[workspace]; !ok {
+			_, _ = fmt.Fprintf(t.pFlags.progress, "%s - workspace has already been deleted\n", workspace)
+			continue
+		}
+		t.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeWorkspace,
+			Action:    changeActionDelete,
+		})
+	}
+}
+
+// planCoreVariables plans changes to the core workspace to stop creating resources in the secondary region
+func (t *teardown) planCoreVariables() error {
+	_, _ = fmt.Fprintln(t.pFlags.progress, "\nChecking core variables...")
+
+	workspace := workspaceName(t.pFlags, Core)
+	if _, ok := t.workspaceIDs[workspace]; !ok {
+		return nil
+	}
+	currentVars, err := t.getVariables(workspace)
+	if err != nil {
+		return err
+	}
+
+	if v := findVar(currentVars, "aws_create_secondary"); v != nil && v.Value != "false" {
+		t.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeVariable,
+			Action:    changeActionUpdate,
+			Key:       "aws_create_secondary",
+			OldValue:  v.Value,
+			NewValue:  "false",
+		})
+	}
+
+	if v := findVar(currentVars, "aws_region_secondary"); v != nil {
+		t.add(SetupChange{
+			Workspace: workspace,
+			Type:      changeTypeVariable,
+			Action:    changeActionDelete,
+			Key:       "aws_region_secondary",
+			OldValue:  v.Value,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package multiregion
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunTeardown(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestAppliedIdp(t, pFlags)
+
+	// failover and failback leave most of the secondary workspaces managing resources
+	setStdin(t, "test\ntest\n")
+	if err := runFailover(context.Background(), tfc, nil, pFlags, failoverOptions{timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runFailback(context.Background(), tfc, pFlags, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "test\n")
+	if err := runTeardown(context.Background(), tfc, pFlags, teardownOptions{destroy: true, timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workspace := range secondaryWorkspaceOrder(pFlags) {
+		if _, ok := tfc.workspaces[workspace]; ok {
+			t.Errorf("workspace %s was not deleted", workspace)
+		}
+	}
+
+	for _, workspace := range []string{workspaceName(pFlags, DbBackup), workspaceName(pFlags, IdBrokerSearch)} {
+		for _, v := range tfc.workspaces[workspace].variables {
+			t.Errorf("%s var.%s was not deleted", workspace, v.Key)
+		}
+	}
+
+	if got, _ := tfc.variable(workspaceName(pFlags, Core), "aws_create_secondary"); got != "false" {
+		t.Errorf("aws_create_secondary = %q, want false", got)
+	}
+	if _, ok := tfc.variable(workspaceName(pFlags, Core), "aws_region_secondary"); ok {
+		t.Error("aws_region_secondary was not deleted")
+	}
+
+	// teardown is idempotent
+	mutations := tfc.mutations
+	plan := newTeardownPlan(t, tfc, pFlags, true)
+	if len(plan.Changes) != 0 {
+		t.Errorf("expected no changes after teardown, got %v", plan.Changes)
+	}
+	if tfc.mutations != mutations {
+		t.Error("planning made changes")
+	}
+}
+
+func TestTeardownPlanOrder(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	plan := newTeardownPlan(t, tfc, pFlags, true)
+
+	// run triggers must be removed before the first destroy run, and each workspace destroyed before it is deleted
+	lastTrigger, firstDestroy := -1, len(plan.Changes)
+	destroyed := map[string]bool{}
+	for i, c := range plan.Changes {
+		switch c.Type {
+		case changeTypeRunTrigger:
+			lastTrigger = i
+		case changeTypeDestroyRun:
+			firstDestroy = min(firstDestroy, i)
+			destroyed[c.Workspace] = true
+		case changeTypeWorkspace:
+			if !destroyed[c.Workspace] {
+				t.Errorf("%s is deleted before it is destroyed", c.Workspace)
+			}
+		}
+	}
+	if lastTrigger > firstDestroy {
+		t.Error("a run trigger is removed after a destroy run")
+	}
+	if len(destroyed) != len(secondaryWorkspaceOrder(pFlags)) {
+		t.Errorf("expected %d destroy runs, got %d", len(secondaryWorkspaceOrder(pFlags)), len(destroyed))
+	}
+}
+
+func TestRunTeardownReadOnly(t *testing.T) {
+	pFlags := testFlags()
+	tfc := newTestMultiregionIdp(t, pFlags)
+	mutations := tfc.mutations
+
+	pFlags.readOnlyMode = true
+	if err := runTeardown(context.Background(), tfc, pFlags, teardownOptions{destroy: true, timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tfc.mutations != mutations {
+		t.Error("read-only mode made changes")
+	}
+	if runs := tfc.workspaceRuns(workspaceName(pFlags, ClusterSecondary)); len(runs) != 0 {
+		t.Errorf("read-only mode started %d runs", len(runs))
+	}
+}
+
+func newTeardownPlan(t *testing.T, tfc TerraformCloud, pFlags PersistentFlags, destroy bool) SetupPlan {
+	s, err := newSetup(context.Background(), tfc, pFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := (&teardown{setup: s}).makePlan(destroy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
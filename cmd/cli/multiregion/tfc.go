@@ -0,0 +1,778 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// Terraform Cloud run statuses, see https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run#run-states
+const (
+	runStatusApplied            = "applied"
+	runStatusPlannedAndFinished = "planned_and_finished"
+	runStatusPlannedAndSaved    = "planned_and_saved"
+	runStatusDiscarded          = "discarded"
+	runStatusErrored            = "errored"
+	runStatusCanceled           = "canceled"
+	runStatusForceCanceled      = "force_canceled"
+)
+
+// runSourceRunTrigger is the source of a run started by a run trigger
+const runSourceRunTrigger = "tfe-run-trigger"
+
+// TerraformCloud is the set of Terraform Cloud operations used by the multiregion commands. Workspaces are
+// identified by name or ID within a single organization.
+type TerraformCloud interface {
+	// FindWorkspaces returns a map of workspace names (key) and IDs (value) of all workspaces with a name containing
+	// the filter string
+	FindWorkspaces(filter string) (map[string]string, error)
+	GetWorkspace(name string) (lib.Workspace, error)
+	GetWorkspaceID(name string) (string, error)
+	UpdateWorkspace(name, attribute, value string) error
+
+	// LockWorkspace locks a workspace, preventing runs from starting until it is unlocked. An error is returned if
+	// the workspace is already locked.
+	LockWorkspace(workspaceID, reason string) error
+
+	// UnlockWorkspace unlocks a workspace. With force, a lock held by another user is also removed.
+	UnlockWorkspace(workspaceID string, force bool) error
+
+	// DeleteWorkspace deletes a workspace, but only if it is not managing any resources
+	DeleteWorkspace(name string) error
+
+	// CloneWorkspace creates a new workspace as a copy of the source workspace, except for its sensitive variables,
+	// which cannot be read
+	CloneWorkspace(source, newName string) error
+
+	ListVariables(workspace string) ([]lib.Var, error)
+	CreateVariable(workspace string, tfVar lib.TFVar) error
+	UpdateVariable(workspace, variableID string, tfVar lib.TFVar) error
+	DeleteVariable(variableID string) error
+
+	// ListStateOutputs returns the names of the outputs in the current state of a workspace
+	ListStateOutputs(workspaceID string) ([]string, error)
+
+	CreateRun(workspaceID, message string) (Run, error)
+	CreateDestroyRun(workspaceID, message string) (Run, error)
+	GetRun(runID string) (Run, error)
+	ListRuns(workspaceID string) ([]Run, error)
+
+	// FindRunTrigger returns true if a run trigger exists on a workspace for the given source workspace
+	FindRunTrigger(workspaceID, sourceID string) (bool, error)
+	CreateRunTrigger(workspaceID, sourceID string) error
+	DeleteRunTrigger(workspaceID, sourceID string) error
+
+	IsGlobalRemoteState(workspaceID string) (bool, error)
+	ListRemoteStateConsumers(workspaceID string) ([]string, error)
+	AddRemoteStateConsumers(workspaceID string, consumerIDs []string) error
+	RemoveRemoteStateConsumers(workspaceID string, consumerIDs []string) error
+}
+
+// tfcClient is the TerraformCloud implementation that calls the Terraform Cloud API. Errors are wrapped with clierr.ErrAPI, or clierr.ErrNotFound if the API returns 404 Not Found. Requests are
+// retried according to the retry policy, and are canceled when the context is canceled.
+type tfcClient struct {
+	ctx    context.Context
+	client *http.Client
+	org    string
+	token  string
+
+	// ids looks up workspace IDs by name. It is normally the workspaceCache that wraps the client, so that each ID
+	// is read only once per command.
+	ids interface {
+		GetWorkspaceID(name string) (string, error)
+	}
+}
+
+// newTerraformCloud returns the TerraformCloud for a command, which caches workspace IDs for the rest of the command
+// and records each change in the audit log
+func newTerraformCloud(ctx context.Context, pFlags PersistentFlags) TerraformCloud {
+	client := &tfcClient{
+		ctx:    ctx,
+		client: &http.Client{Transport: newRetryTransport(http.DefaultTransport, pFlags.retry)},
+		org:    pFlags.org,
+		token:  pFlags.tfcToken,
+	}
+	cache := newWorkspaceCache(client)
+	client.ids = cache
+
+	var tfc TerraformCloud = cache
+	if pFlags.auditLog != nil {
+		tfc = newAuditedTerraformCloud(tfc, pFlags.auditLog)
+	}
+	return tfc
+}
+
+// FindWorkspaces searches for workspaces by name
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#list-workspaces
+func (t *tfcClient) FindWorkspaces(filter string) (map[string]string, error) {
+	u := lib.NewTfcUrl("/organizations/" + t.org + "/workspaces")
+	u.SetParam("search[name]", filter)
+	u.SetParam("page[size]", "100")
+
+	workspaces := map[string]string{}
+	for page := 1; page > 0; {
+		u.SetParam("page[number]", strconv.Itoa(page))
+
+		var response struct {
+			Data []lib.Workspace `json:"data"`
+			Meta pageMeta        `json:"meta"`
+		}
+		if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+			return nil, fmt.Errorf("failed to find workspaces matching %q: %w", filter, err)
+		}
+
+		for _, w := range response.Data {
+			workspaces[w.Attributes.Name] = w.ID
+		}
+		page = response.Meta.Pagination.NextPage
+	}
+	return workspaces, nil
+}
+
+// pageMeta is the pagination metadata of a list response
+type pageMeta struct {
+	Pagination struct {
+		NextPage int `json:"next-page"`
+	} `json:"pagination"`
+}
+
+// GetWorkspace reads the properties of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#show-workspace
+func (t *tfcClient) GetWorkspace(name string) (lib.Workspace, error) {
+	var response struct {
+		Data lib.Workspace `json:"data"`
+	}
+	u := lib.NewTfcUrl("/organizations/" + t.org + "/workspaces/" + name)
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return lib.Workspace{}, fmt.Errorf("failed to get workspace %s: %w", name, err)
+	}
+	return response.Data, nil
+}
+
+// GetWorkspaceID returns the ID of a workspace
+func (t *tfcClient) GetWorkspaceID(name string) (string, error) {
+	w, err := t.GetWorkspace(name)
+	if err != nil {
+		return "", err
+	}
+	return w.ID, nil
+}
+
+// workspaceID returns the ID of a workspace, using the workspace cache if there is one
+func (t *tfcClient) workspaceID(name string) (string, error) {
+	if t.ids != nil {
+		return t.ids.GetWorkspaceID(name)
+	}
+	return t.GetWorkspaceID(name)
+}
+
+// UpdateWorkspace sets one string attribute of a workspace, e.g. lib.WsAttrWorkingDirectory
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#update-a-workspace
+func (t *tfcClient) UpdateWorkspace(name, attribute, value string) error {
+	payload := map[string]any{
+		"data": map[string]any{
+			"type":       "workspaces",
+			"attributes": map[string]any{attribute: value},
+		},
+	}
+	u := lib.NewTfcUrl("/organizations/" + t.org + "/workspaces/" + name)
+	if err := t.callAPI(http.MethodPatch, u, payload, nil); err != nil {
+		return fmt.Errorf("failed to set %s on workspace %s: %w", attribute, name, err)
+	}
+	return nil
+}
+
+// CloneWorkspace creates a new workspace with the settings, variable sets, non-sensitive variables, and team access
+// of the source workspace. Sensitive values cannot be read, so sensitive variables are not created.
+func (t *tfcClient) CloneWorkspace(source, newName string) error {
+	s, err := t.GetWorkspace(source)
+	if err != nil {
+		return err
+	}
+	vars, err := t.ListVariables(source)
+	if err != nil {
+		return err
+	}
+
+	w, err := t.createWorkspace(newName, s)
+	if err != nil {
+		return err
+	}
+	if err = t.copyVariableSets(s.ID, w.ID); err != nil {
+		return err
+	}
+
+	for _, v := range vars {
+		if v.Sensitive {
+			continue
+		}
+		if err = t.createVariable(w.ID, newName, lib.TFVar{Key: v.Key, Value: v.Value, Hcl: v.Hcl}); err != nil {
+			return err
+		}
+	}
+
+	return t.copyTeamAccess(s.ID, w.ID)
+}
+
+// createWorkspace creates a workspace with the Terraform version, working directory, and VCS repository of the source
+// workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#create-a-workspace
+func (t *tfcClient) createWorkspace(name string, source lib.Workspace) (lib.Workspace, error) {
+	attributes := map[string]any{
+		"name":              name,
+		"terraform-version": source.Attributes.TerraformVersion,
+		"working-directory": source.Attributes.WorkingDirectory,
+	}
+	if repo := source.Attributes.VCSRepo; repo.TokenID != "" {
+		attributes["vcs-repo"] = map[string]any{
+			"identifier":     repo.Identifier,
+			"oauth-token-id": repo.TokenID,
+			"branch":         repo.Branch,
+		}
+	}
+	payload := map[string]any{
+		"data": map[string]any{"type": "workspaces", "attributes": attributes},
+	}
+
+	var response struct {
+		Data lib.Workspace `json:"data"`
+	}
+	u := lib.NewTfcUrl("/organizations/" + t.org + "/workspaces")
+	if err := t.callAPI(http.MethodPost, u, payload, &response); err != nil {
+		return lib.Workspace{}, fmt.Errorf("failed to create workspace %s: %w", name, err)
+	}
+	return response.Data, nil
+}
+
+// copyVariableSets applies the variable sets of one workspace to another. Global variable sets already apply to
+// every workspace, so they are skipped.
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/variable-sets#list-variable-sets
+func (t *tfcClient) copyVariableSets(sourceID, workspaceID string) error {
+	var response struct {
+		Data []struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Name   string `json:"name"`
+				Global bool   `json:"global"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	u := lib.NewTfcUrl("/workspaces/" + sourceID + "/varsets")
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return fmt.Errorf("failed to list variable sets for workspace %s: %w", sourceID, err)
+	}
+
+	for _, set := range response.Data {
+		if set.Attributes.Global {
+			continue
+		}
+		u = lib.NewTfcUrl("/varsets/" + set.ID + "/relationships/workspaces")
+		if err := t.callAPI(http.MethodPost, u, workspaceRefs([]string{workspaceID}), nil); err != nil {
+			return fmt.Errorf("failed to apply variable set %s: %w", set.Attributes.Name, err)
+		}
+	}
+	return nil
+}
+
+// copyTeamAccess gives each team the same access to a workspace as it has to the source workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/team-access
+func (t *tfcClient) copyTeamAccess(sourceID, workspaceID string) error {
+	u := lib.NewTfcUrl("/team-workspaces")
+	u.SetParam("filter[workspace][id]", sourceID)
+
+	var response lib.AllTeamWorkspaceData
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return fmt.Errorf("failed to get team access for workspace %s: %w", sourceID, err)
+	}
+
+	for _, d := range response.Data {
+		payload := map[string]any{
+			"data": map[string]any{
+				"type":       "team-workspaces",
+				"attributes": map[string]any{"access": d.Attributes.Access},
+				"relationships": map[string]any{
+					"workspace": map[string]any{"data": map[string]any{"type": "workspaces", "id": workspaceID}},
+					"team":      map[string]any{"data": map[string]any{"type": "teams", "id": d.Relationships.Team.Data.ID}},
+				},
+			},
+		}
+		if err := t.callAPI(http.MethodPost, lib.NewTfcUrl("/team-workspaces"), payload, nil); err != nil {
+			return fmt.Errorf("failed to give team %s access to workspace %s: %w", d.Relationships.Team.Data.ID,
+				workspaceID, err)
+		}
+	}
+	return nil
+}
+
+// ListVariables returns the variables of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspace-variables#list-variables
+func (t *tfcClient) ListVariables(workspace string) ([]lib.Var, error) {
+	id, err := t.workspaceID(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	var response lib.VarsResponse
+	if err = t.callAPI(http.MethodGet, lib.NewTfcUrl("/workspaces/"+id+"/vars"), nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list variables for workspace %s: %w", workspace, err)
+	}
+
+	vars := make([]lib.Var, len(response.Data))
+	for i, d := range response.Data {
+		vars[i] = d.Variable
+		vars[i].ID = d.ID
+	}
+	return vars, nil
+}
+
+// CreateVariable creates a Terraform variable in a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspace-variables#create-a-variable
+func (t *tfcClient) CreateVariable(workspace string, tfVar lib.TFVar) error {
+	id, err := t.workspaceID(workspace)
+	if err != nil {
+		return err
+	}
+	return t.createVariable(id, workspace, tfVar)
+}
+
+func (t *tfcClient) createVariable(workspaceID, workspace string, tfVar lib.TFVar) error {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/vars")
+	if err := t.callAPI(http.MethodPost, u, variablePayload("", tfVar), nil); err != nil {
+		return fmt.Errorf("failed to create %s var.%s: %w", workspace, tfVar.Key, err)
+	}
+	return nil
+}
+
+// UpdateVariable updates the value and properties of a Terraform variable
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspace-variables#update-variables
+func (t *tfcClient) UpdateVariable(workspace, variableID string, tfVar lib.TFVar) error {
+	u := lib.NewTfcUrl("/vars/" + variableID)
+	if err := t.callAPI(http.MethodPatch, u, variablePayload(variableID, tfVar), nil); err != nil {
+		return fmt.Errorf("failed to update %s var.%s: %w", workspace, tfVar.Key, err)
+	}
+	return nil
+}
+
+// DeleteVariable deletes a Terraform variable
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspace-variables#delete-variables
+func (t *tfcClient) DeleteVariable(variableID string) error {
+	u := lib.NewTfcUrl("/vars/" + variableID)
+	if err := t.callAPI(http.MethodDelete, u, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete variable %s: %w", variableID, err)
+	}
+	return nil
+}
+
+// variablePayload returns the request body to create or update a Terraform variable. The variable ID is only
+// included for an update.
+func variablePayload(variableID string, tfVar lib.TFVar) map[string]any {
+	data := map[string]any{
+		"type": "vars",
+		"attributes": map[string]any{
+			"key":       tfVar.Key,
+			"value":     tfVar.Value,
+			"category":  "terraform",
+			"hcl":       tfVar.Hcl,
+			"sensitive": tfVar.Sensitive,
+		},
+	}
+	if variableID != "" {
+		data["id"] = variableID
+	}
+	return map[string]any{"data": data}
+}
+
+func (t *tfcClient) FindRunTrigger(workspaceID, sourceID string) (bool, error) {
+	triggers, err := t.listRunTriggers(workspaceID)
+	if err != nil {
+		return false, err
+	}
+	_, ok := triggers[sourceID]
+	return ok, nil
+}
+
+// CreateRunTrigger creates a run trigger on a workspace for the given source workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run-triggers#create-a-run-trigger
+func (t *tfcClient) CreateRunTrigger(workspaceID, sourceID string) error {
+	payload := map[string]any{
+		"data": map[string]any{
+			"relationships": map[string]any{
+				"sourceable": map[string]any{"data": map[string]any{"type": "workspaces", "id": sourceID}},
+			},
+		},
+	}
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/run-triggers")
+	if err := t.callAPI(http.MethodPost, u, payload, nil); err != nil {
+		return fmt.Errorf("failed to create run trigger on workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// AddRemoteStateConsumers adds workspaces to the list of workspaces allowed to read the state of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#add-remote-state-consumers
+func (t *tfcClient) AddRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/relationships/remote-state-consumers")
+	if err := t.callAPI(http.MethodPost, u, workspaceRefs(consumerIDs), nil); err != nil {
+		return fmt.Errorf("failed to add remote state consumers to workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// workspaceRefs returns a request body that lists workspaces by ID
+func workspaceRefs(ids []string) map[string]any {
+	data := make([]map[string]string, len(ids))
+	for i, id := range ids {
+		data[i] = map[string]string{"type": "workspaces", "id": id}
+	}
+	return map[string]any{"data": data}
+}
+
+// Run is a Terraform Cloud run
+type Run struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	Source     string    `json:"source"`
+	HasChanges bool      `json:"has-changes"`
+	IsDestroy  bool      `json:"is-destroy"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created-at"`
+
+	StatusTimestamps runTimestamps `json:"status-timestamps"`
+}
+
+// runTimestamps is the time a run reached each status, if it has
+type runTimestamps struct {
+	AppliedAt time.Time `json:"applied-at"`
+}
+
+// appliedAt returns the time the run was applied, or the time it was created if that is not known
+func (r Run) appliedAt() time.Time {
+	if r.StatusTimestamps.AppliedAt.IsZero() {
+		return r.CreatedAt
+	}
+	return r.StatusTimestamps.AppliedAt
+}
+
+// isTriggeredAfter returns true if the run was started by a run trigger at or after the given time
+func (r Run) isTriggeredAfter(t time.Time) bool {
+	return r.Source == runSourceRunTrigger && !r.CreatedAt.Before(t)
+}
+
+// isFinished returns true if the run has reached a terminal state
+func (r Run) isFinished() bool {
+	switch r.Status {
+	case runStatusApplied, runStatusPlannedAndFinished, runStatusPlannedAndSaved, runStatusDiscarded,
+		runStatusErrored, runStatusCanceled, runStatusForceCanceled:
+		return true
+	}
+	return false
+}
+
+// isSuccessful returns true if the run finished without error and was not discarded or canceled
+func (r Run) isSuccessful() bool {
+	return r.Status == runStatusApplied || r.Status == runStatusPlannedAndFinished
+}
+
+type runData struct {
+	ID         string `json:"id"`
+	Attributes Run    `json:"attributes"`
+}
+
+func (d runData) run() Run {
+	r := d.Attributes
+	r.ID = d.ID
+	return r
+}
+
+// CreateRun creates a new run on a workspace and returns the new run. Unlike lib.CreateRun, the run ID is returned
+// so the run can be monitored.
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run#create-a-run
+func (t *tfcClient) CreateRun(workspaceID, message string) (Run, error) {
+	return t.createRun(workspaceID, message, false)
+}
+
+// CreateDestroyRun creates a new run on a workspace that destroys all resources managed by the workspace
+func (t *tfcClient) CreateDestroyRun(workspaceID, message string) (Run, error) {
+	return t.createRun(workspaceID, message, true)
+}
+
+func (t *tfcClient) createRun(workspaceID, message string, isDestroy bool) (Run, error) {
+	payload := map[string]any{
+		"data": map[string]any{
+			"type": "runs",
+			"attributes": map[string]any{
+				"message":    message,
+				"is-destroy": isDestroy,
+			},
+			"relationships": map[string]any{
+				"workspace": map[string]any{
+					"data": map[string]any{"type": "workspaces", "id": workspaceID},
+				},
+			},
+		},
+	}
+
+	var response struct {
+		Data runData `json:"data"`
+	}
+	u := lib.NewTfcUrl("/runs")
+	if err := t.callAPI(http.MethodPost, u, payload, &response); err != nil {
+		return Run{}, fmt.Errorf("failed to create run: %w", err)
+	}
+	return response.Data.run(), nil
+}
+
+// GetRun reads the current properties of a run
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run#get-run-details
+func (t *tfcClient) GetRun(runID string) (Run, error) {
+	var response struct {
+		Data runData `json:"data"`
+	}
+	u := lib.NewTfcUrl("/runs/" + runID)
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return Run{}, fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	return response.Data.run(), nil
+}
+
+// ListRuns returns the first page of runs on a workspace, most recent first
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run#list-runs-in-a-workspace
+func (t *tfcClient) ListRuns(workspaceID string) ([]Run, error) {
+	var response struct {
+		Data []runData `json:"data"`
+	}
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/runs")
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list runs for workspace %s: %w", workspaceID, err)
+	}
+
+	runs := make([]Run, len(response.Data))
+	for i, d := range response.Data {
+		runs[i] = d.run()
+	}
+	return runs, nil
+}
+
+// LockWorkspace locks a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#lock-a-workspace
+func (t *tfcClient) LockWorkspace(workspaceID, reason string) error {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/actions/lock")
+	if err := t.callAPI(http.MethodPost, u, map[string]string{"reason": reason}, nil); err != nil {
+		return fmt.Errorf("failed to lock workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// UnlockWorkspace unlocks a workspace. Force unlocking requires admin access to the workspace. The request is made
+// even if the command was interrupted, so that workspaces are not left locked.
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#unlock-a-workspace
+func (t *tfcClient) UnlockWorkspace(workspaceID string, force bool) error {
+	action := "unlock"
+	if force {
+		action = "force-unlock"
+	}
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/actions/" + action)
+	unlockClient := *t
+	unlockClient.ctx = context.WithoutCancel(t.ctx)
+	if err := unlockClient.callAPI(http.MethodPost, u, nil, nil); err != nil {
+		return fmt.Errorf("failed to unlock workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
+
+// ListStateOutputs returns the names of the first page of outputs in the current state version of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/state-version-outputs#show-current-state-for-workspace
+func (t *tfcClient) ListStateOutputs(workspaceID string) ([]string, error) {
+	var response struct {
+		Data []struct {
+			Attributes struct {
+				Name string `json:"name"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/current-state-version-outputs")
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list state outputs for workspace %s: %w", workspaceID, err)
+	}
+
+	names := make([]string, len(response.Data))
+	for i, d := range response.Data {
+		names[i] = d.Attributes.Name
+	}
+	return names, nil
+}
+
+// callAPI makes a Terraform Cloud API call. If body is not nil, it is sent as the JSON request body. If result is
+// not nil, the JSON response body is decoded into it.
+func (t *tfcClient) callAPI(method string, u lib.TfcUrl, body, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(t.ctx, method, u.String(), reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return interruptedError(t.ctx, fmt.Errorf("%w: %s %s failed: %w", clierr.ErrAPI, method, u.Path, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		kind := clierr.ErrAPI
+		if resp.StatusCode == http.StatusNotFound {
+			kind = clierr.ErrNotFound
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s %s returned %s: %s", kind, method, u.Path, resp.Status, respBody)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%w: failed to decode response from %s %s: %w", clierr.ErrAPI, method, u.Path, err)
+	}
+	return nil
+}
+
+// ListRemoteStateConsumers returns the IDs of the workspaces that are allowed to read the state of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#get-remote-state-consumers
+func (t *tfcClient) ListRemoteStateConsumers(workspaceID string) ([]string, error) {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/relationships/remote-state-consumers")
+	u.SetParam("page[size]", "100")
+
+	var consumerIDs []string
+	for page := 1; page > 0; {
+		u.SetParam("page[number]", strconv.Itoa(page))
+
+		var response struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			Meta pageMeta `json:"meta"`
+		}
+		if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+			return nil, fmt.Errorf("failed to list remote state consumers for workspace %s: %w", workspaceID, err)
+		}
+
+		for _, d := range response.Data {
+			consumerIDs = append(consumerIDs, d.ID)
+		}
+		page = response.Meta.Pagination.NextPage
+	}
+	return consumerIDs, nil
+}
+
+// IsGlobalRemoteState returns true if a workspace shares its state with all workspaces in the organization
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#show-workspace
+func (t *tfcClient) IsGlobalRemoteState(workspaceID string) (bool, error) {
+	var response struct {
+		Data struct {
+			Attributes struct {
+				GlobalRemoteState bool `json:"global-remote-state"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID)
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return false, fmt.Errorf("failed to get workspace %s: %w", workspaceID, err)
+	}
+	return response.Data.Attributes.GlobalRemoteState, nil
+}
+
+// DeleteWorkspace deletes a workspace using the safe delete action, which fails if the workspace is managing any
+// resources
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#safe-delete-a-workspace
+func (t *tfcClient) DeleteWorkspace(name string) error {
+	id, err := t.workspaceID(name)
+	if err != nil {
+		return err
+	}
+
+	u := lib.NewTfcUrl("/workspaces/" + id + "/actions/safe-delete")
+	if err = t.callAPI(http.MethodPost, u, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete workspace %s: %w", name, err)
+	}
+	return nil
+}
+
+// listRunTriggers returns the first page of inbound run triggers on a workspace, as a map of source workspace IDs
+// (key) and run trigger IDs (value)
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run-triggers#list-run-triggers
+func (t *tfcClient) listRunTriggers(workspaceID string) (map[string]string, error) {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/run-triggers")
+	u.SetParam("filter[run-trigger][type]", "inbound")
+
+	var response struct {
+		Data []struct {
+			ID            string `json:"id"`
+			Relationships struct {
+				Sourceable struct {
+					Data struct {
+						ID string `json:"id"`
+					} `json:"data"`
+				} `json:"sourceable"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := t.callAPI(http.MethodGet, u, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list run triggers for workspace %s: %w", workspaceID, err)
+	}
+
+	triggers := map[string]string{}
+	for _, d := range response.Data {
+		triggers[d.Relationships.Sourceable.Data.ID] = d.ID
+	}
+	return triggers, nil
+}
+
+// DeleteRunTrigger deletes the run trigger on a workspace for the given source workspace, if it exists
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/run-triggers#delete-a-run-trigger
+func (t *tfcClient) DeleteRunTrigger(workspaceID, sourceID string) error {
+	triggers, err := t.listRunTriggers(workspaceID)
+	if err != nil {
+		return err
+	}
+
+	id, ok := triggers[sourceID]
+	if !ok {
+		return nil
+	}
+	if err = t.callAPI(http.MethodDelete, lib.NewTfcUrl("/run-triggers/"+id), nil, nil); err != nil {
+		return fmt.Errorf("failed to delete run trigger %s: %w", id, err)
+	}
+	return nil
+}
+
+// RemoveRemoteStateConsumers removes workspaces from the list of workspaces allowed to read the state of a workspace
+// https://developer.hashicorp.com/terraform/cloud-docs/api-docs/workspaces#delete-remote-state-consumers
+func (t *tfcClient) RemoveRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	u := lib.NewTfcUrl("/workspaces/" + workspaceID + "/relationships/remote-state-consumers")
+	if err := t.callAPI(http.MethodDelete, u, workspaceRefs(consumerIDs), nil); err != nil {
+		return fmt.Errorf("failed to remove remote state consumers from workspace %s: %w", workspaceID, err)
+	}
+	return nil
+}
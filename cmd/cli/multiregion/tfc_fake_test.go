@@ -0,0 +1,515 @@
+package multiregion
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// fakeTerraformCloud is an in-memory TerraformCloud. Runs start as pending and are applied the next time they are
+// read, at which point runs are started on any workspaces with a run trigger sourced by the applied workspace.
+type fakeTerraformCloud struct {
+	workspaces map[string]*fakeWorkspace
+	runs       map[string]*fakeRun
+
+	// failRuns is a set of workspace names whose runs finish with an error
+	failRuns map[string]bool
+
+	// noChanges is a set of workspace names whose runs have nothing to apply, so they do not start triggered runs
+	noChanges map[string]bool
+
+	// failMethods is a set of method names that return an API error, e.g. "CloneWorkspace"
+	failMethods map[string]bool
+
+	// triggerDelay is the number of times a run started by a run trigger is left out of ListRuns
+	triggerDelay int
+
+	// mutations counts the calls that change anything other than runs and locks
+	mutations int
+
+	// workspaceReads counts the calls that read a workspace by name
+	workspaceReads atomic.Int32
+
+	// locked lists the names of the workspaces in the order they were locked
+	locked []string
+
+	nextID int
+	clock  time.Time
+}
+
+type fakeWorkspace struct {
+	workspace         lib.Workspace
+	managesResources  bool
+	variables         []lib.Var
+	runIDs            []string
+	triggerSourceIDs  []string
+	consumerIDs       []string
+	globalRemoteState bool
+	lockReason        string
+}
+
+type fakeRun struct {
+	Run
+	workspaceID string
+
+	// hidden is the number of times the run is left out of ListRuns
+	hidden int
+}
+
+func newFakeTerraformCloud() *fakeTerraformCloud {
+	return &fakeTerraformCloud{
+		workspaces:  map[string]*fakeWorkspace{},
+		runs:        map[string]*fakeRun{},
+		failRuns:    map[string]bool{},
+		noChanges:   map[string]bool{},
+		failMethods: map[string]bool{},
+		clock:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (f *fakeTerraformCloud) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+// addWorkspace creates a workspace with the given working directory and non-sensitive variables
+func (f *fakeTerraformCloud) addWorkspace(name, workingDirectory string, vars map[string]string) *fakeWorkspace {
+	w := &fakeWorkspace{}
+	w.workspace.ID = f.newID("ws")
+	w.workspace.Type = "workspaces"
+	w.workspace.Attributes.Name = name
+	w.workspace.Attributes.WorkingDirectory = workingDirectory
+	for _, key := range sortedKeys(vars) {
+		w.variables = append(w.variables, lib.Var{ID: f.newID("var"), Key: key, Value: vars[key], Category: "terraform"})
+	}
+	f.workspaces[name] = w
+	return w
+}
+
+// variable returns the value of a variable, and false if the workspace or variable does not exist
+func (f *fakeTerraformCloud) variable(workspace, key string) (string, bool) {
+	w, ok := f.workspaces[workspace]
+	if !ok {
+		return "", false
+	}
+	v := findVar(w.variables, key)
+	if v == nil {
+		return "", false
+	}
+	return v.Value, true
+}
+
+// fail returns an API error if the method is set to fail
+func (f *fakeTerraformCloud) fail(method string) error {
+	if f.failMethods[method] {
+		return fmt.Errorf("%w: %s failed", clierr.ErrAPI, method)
+	}
+	return nil
+}
+
+func (f *fakeTerraformCloud) workspaceByID(id string) (*fakeWorkspace, error) {
+	for _, w := range f.workspaces {
+		if w.workspace.ID == id {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("workspace ID %s not found", id)
+}
+
+func (f *fakeTerraformCloud) workspaceByName(name string) (*fakeWorkspace, error) {
+	w, ok := f.workspaces[name]
+	if !ok {
+		return nil, fmt.Errorf("workspace %s not found", name)
+	}
+	return w, nil
+}
+
+func (f *fakeTerraformCloud) FindWorkspaces(filter string) (map[string]string, error) {
+	found := map[string]string{}
+	for name, w := range f.workspaces {
+		if strings.Contains(name, filter) {
+			found[name] = w.workspace.ID
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeTerraformCloud) GetWorkspace(name string) (lib.Workspace, error) {
+	f.workspaceReads.Add(1)
+	w, err := f.workspaceByName(name)
+	if err != nil {
+		return lib.Workspace{}, err
+	}
+	return w.workspace, nil
+}
+
+func (f *fakeTerraformCloud) GetWorkspaceID(name string) (string, error) {
+	w, err := f.GetWorkspace(name)
+	return w.ID, err
+}
+
+func (f *fakeTerraformCloud) UpdateWorkspace(name, attribute, value string) error {
+	if err := f.fail("UpdateWorkspace"); err != nil {
+		return err
+	}
+	w, err := f.workspaceByName(name)
+	if err != nil {
+		return err
+	}
+	if attribute != lib.WsAttrWorkingDirectory {
+		return fmt.Errorf("attribute %s is not supported", attribute)
+	}
+	f.mutations++
+	w.workspace.Attributes.WorkingDirectory = value
+	return nil
+}
+
+func (f *fakeTerraformCloud) LockWorkspace(workspaceID, reason string) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	if w.workspace.Attributes.Locked {
+		return fmt.Errorf("workspace %s is already locked", w.workspace.Attributes.Name)
+	}
+	w.workspace.Attributes.Locked = true
+	w.lockReason = reason
+	f.locked = append(f.locked, w.workspace.Attributes.Name)
+	return nil
+}
+
+func (f *fakeTerraformCloud) UnlockWorkspace(workspaceID string, force bool) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	if !w.workspace.Attributes.Locked {
+		return fmt.Errorf("workspace %s is not locked", w.workspace.Attributes.Name)
+	}
+	w.workspace.Attributes.Locked = false
+	w.lockReason = ""
+	return nil
+}
+
+// lockedWorkspaces returns the names of the workspaces that are currently locked
+func (f *fakeTerraformCloud) lockedWorkspaces() []string {
+	var locked []string
+	for _, name := range sortedKeys(f.workspaces) {
+		if f.workspaces[name].workspace.Attributes.Locked {
+			locked = append(locked, name)
+		}
+	}
+	return locked
+}
+
+func (f *fakeTerraformCloud) DeleteWorkspace(name string) error {
+	w, err := f.workspaceByName(name)
+	if err != nil {
+		return err
+	}
+	if w.managesResources {
+		return fmt.Errorf("workspace %s is managing resources", name)
+	}
+	f.mutations++
+	delete(f.workspaces, name)
+
+	// deleting a workspace also removes it from run triggers and remote state consumers of other workspaces
+	for _, other := range f.workspaces {
+		other.triggerSourceIDs = slices.DeleteFunc(other.triggerSourceIDs, func(id string) bool { return id == w.workspace.ID })
+		other.consumerIDs = slices.DeleteFunc(other.consumerIDs, func(id string) bool { return id == w.workspace.ID })
+	}
+	return nil
+}
+
+func (f *fakeTerraformCloud) CloneWorkspace(source, newName string) error {
+	if err := f.fail("CloneWorkspace"); err != nil {
+		return err
+	}
+	s, err := f.workspaceByName(source)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.workspaces[newName]; ok {
+		return fmt.Errorf("workspace %s already exists", newName)
+	}
+	f.mutations++
+
+	w := f.addWorkspace(newName, s.workspace.Attributes.WorkingDirectory, nil)
+	for _, v := range s.variables {
+		if v.Sensitive {
+			continue
+		}
+		v.ID = f.newID("var")
+		w.variables = append(w.variables, v)
+	}
+	return nil
+}
+
+func (f *fakeTerraformCloud) ListVariables(workspace string) ([]lib.Var, error) {
+	if err := f.fail("ListVariables"); err != nil {
+		return nil, err
+	}
+	w, err := f.workspaceByName(workspace)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(w.variables), nil
+}
+
+func (f *fakeTerraformCloud) CreateVariable(workspace string, tfVar lib.TFVar) error {
+	w, err := f.workspaceByName(workspace)
+	if err != nil {
+		return err
+	}
+	if findVar(w.variables, tfVar.Key) != nil {
+		return fmt.Errorf("variable %s already exists in %s", tfVar.Key, workspace)
+	}
+	f.mutations++
+	w.variables = append(w.variables, lib.Var{
+		ID:        f.newID("var"),
+		Key:       tfVar.Key,
+		Value:     tfVar.Value,
+		Hcl:       tfVar.Hcl,
+		Sensitive: tfVar.Sensitive,
+		Category:  "terraform",
+	})
+	return nil
+}
+
+func (f *fakeTerraformCloud) UpdateVariable(workspace, variableID string, tfVar lib.TFVar) error {
+	if err := f.fail("UpdateVariable"); err != nil {
+		return err
+	}
+	w, err := f.workspaceByName(workspace)
+	if err != nil {
+		return err
+	}
+	for i := range w.variables {
+		if w.variables[i].ID == variableID {
+			f.mutations++
+			w.variables[i].Key = tfVar.Key
+			w.variables[i].Value = tfVar.Value
+			w.variables[i].Hcl = tfVar.Hcl
+			w.variables[i].Sensitive = tfVar.Sensitive
+			return nil
+		}
+	}
+	return fmt.Errorf("variable ID %s not found in %s", variableID, workspace)
+}
+
+func (f *fakeTerraformCloud) DeleteVariable(variableID string) error {
+	for _, w := range f.workspaces {
+		for i, v := range w.variables {
+			if v.ID == variableID {
+				f.mutations++
+				w.variables = slices.Delete(w.variables, i, i+1)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("variable ID %s not found", variableID)
+}
+
+func (f *fakeTerraformCloud) CreateRun(workspaceID, message string) (Run, error) {
+	return f.createRun(workspaceID, message, false)
+}
+
+func (f *fakeTerraformCloud) CreateDestroyRun(workspaceID, message string) (Run, error) {
+	return f.createRun(workspaceID, message, true)
+}
+
+func (f *fakeTerraformCloud) createRun(workspaceID, message string, isDestroy bool) (Run, error) {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return Run{}, err
+	}
+	if w.workspace.Attributes.Locked {
+		return Run{}, fmt.Errorf("workspace %s is locked", w.workspace.Attributes.Name)
+	}
+
+	f.clock = f.clock.Add(time.Second)
+	r := &fakeRun{
+		Run: Run{
+			ID:        f.newID("run"),
+			Status:    "pending",
+			Source:    "tfe-api",
+			Message:   message,
+			IsDestroy: isDestroy,
+			CreatedAt: f.clock,
+		},
+		workspaceID: workspaceID,
+	}
+	f.runs[r.ID] = r
+	w.runIDs = append(w.runIDs, r.ID)
+	return r.Run, nil
+}
+
+// GetRun returns a run, finishing it if it is pending. Runs on downstream workspaces are started when a run is
+// applied.
+func (f *fakeTerraformCloud) GetRun(runID string) (Run, error) {
+	r, ok := f.runs[runID]
+	if !ok {
+		return Run{}, fmt.Errorf("run %s not found", runID)
+	}
+	if r.Status != "pending" {
+		return r.Run, nil
+	}
+
+	w, err := f.workspaceByID(r.workspaceID)
+	if err != nil {
+		return Run{}, err
+	}
+	if f.failRuns[w.workspace.Attributes.Name] {
+		r.Status = runStatusErrored
+		return r.Run, nil
+	}
+	if f.noChanges[w.workspace.Attributes.Name] {
+		r.Status = runStatusPlannedAndFinished
+		return r.Run, nil
+	}
+
+	f.clock = f.clock.Add(time.Second)
+	r.Status = runStatusApplied
+	r.StatusTimestamps.AppliedAt = f.clock
+	w.managesResources = !r.IsDestroy
+	for _, name := range sortedKeys(f.workspaces) {
+		if slices.Contains(f.workspaces[name].triggerSourceIDs, r.workspaceID) {
+			triggered, err := f.CreateRun(f.workspaces[name].workspace.ID, "Triggered by "+w.workspace.Attributes.Name)
+			if err != nil {
+				return Run{}, err
+			}
+			f.runs[triggered.ID].Source = runSourceRunTrigger
+			f.runs[triggered.ID].hidden = f.triggerDelay
+		}
+	}
+	return r.Run, nil
+}
+
+func (f *fakeTerraformCloud) ListRuns(workspaceID string) ([]Run, error) {
+	if err := f.fail("ListRuns"); err != nil {
+		return nil, err
+	}
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]Run, 0, len(w.runIDs))
+	for i := len(w.runIDs) - 1; i >= 0; i-- {
+		if r := f.runs[w.runIDs[i]]; r.hidden > 0 {
+			r.hidden--
+			continue
+		}
+		runs = append(runs, f.runs[w.runIDs[i]].Run)
+	}
+	return runs, nil
+}
+
+// workspaceRuns returns the runs on a workspace in the order they were created
+func (f *fakeTerraformCloud) workspaceRuns(workspace string) []Run {
+	var runs []Run
+	if w, ok := f.workspaces[workspace]; ok {
+		for _, id := range w.runIDs {
+			runs = append(runs, f.runs[id].Run)
+		}
+	}
+	return runs
+}
+
+func (f *fakeTerraformCloud) FindRunTrigger(workspaceID, sourceID string) (bool, error) {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(w.triggerSourceIDs, sourceID), nil
+}
+
+func (f *fakeTerraformCloud) CreateRunTrigger(workspaceID, sourceID string) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	if _, err = f.workspaceByID(sourceID); err != nil {
+		return err
+	}
+	f.mutations++
+	w.triggerSourceIDs = append(w.triggerSourceIDs, sourceID)
+	return nil
+}
+
+// ListStateOutputs returns a single output for a workspace that manages resources, and none otherwise
+func (f *fakeTerraformCloud) ListStateOutputs(workspaceID string) ([]string, error) {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !w.managesResources {
+		return nil, nil
+	}
+	return []string{"id"}, nil
+}
+
+// addAppliedRun adds an applied run to a workspace, without starting runs on other workspaces
+func (f *fakeTerraformCloud) addAppliedRun(workspace string) {
+	w := f.workspaces[workspace]
+	run, _ := f.createRun(w.workspace.ID, "applied", false)
+	f.runs[run.ID].Status = runStatusApplied
+	f.runs[run.ID].StatusTimestamps.AppliedAt = run.CreatedAt
+	w.managesResources = true
+}
+
+func (f *fakeTerraformCloud) IsGlobalRemoteState(workspaceID string) (bool, error) {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return false, err
+	}
+	return w.globalRemoteState, nil
+}
+
+func (f *fakeTerraformCloud) ListRemoteStateConsumers(workspaceID string) ([]string, error) {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(w.consumerIDs), nil
+}
+
+func (f *fakeTerraformCloud) AddRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	f.mutations++
+	for _, id := range consumerIDs {
+		if !slices.Contains(w.consumerIDs, id) {
+			w.consumerIDs = append(w.consumerIDs, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeTerraformCloud) DeleteRunTrigger(workspaceID, sourceID string) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	f.mutations++
+	w.triggerSourceIDs = slices.DeleteFunc(w.triggerSourceIDs, func(id string) bool { return id == sourceID })
+	return nil
+}
+
+func (f *fakeTerraformCloud) RemoveRemoteStateConsumers(workspaceID string, consumerIDs []string) error {
+	w, err := f.workspaceByID(workspaceID)
+	if err != nil {
+		return err
+	}
+	f.mutations++
+	w.consumerIDs = slices.DeleteFunc(w.consumerIDs, func(id string) bool { return slices.Contains(consumerIDs, id) })
+	return nil
+}
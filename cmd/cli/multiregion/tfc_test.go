@@ -0,0 +1,82 @@
+package multiregion
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// serverTransport sends every request to a test server instead of Terraform Cloud
+type serverTransport struct {
+	server *url.URL
+}
+
+func (s serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = s.server.Scheme
+	req.URL.Host = s.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestTfcClient returns a tfcClient that sends requests to a test server with the given handler
+func newTestTfcClient(t *testing.T, handler http.HandlerFunc) *tfcClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	return &tfcClient{
+		ctx:    context.Background(),
+		client: &http.Client{Transport: serverTransport{server: u}},
+		org:    "org",
+		token:  "token",
+	}
+}
+
+func TestTfcClientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		call     func(tfc *tfcClient) error
+		wantExit int
+	}{
+		{"find workspaces", http.StatusInternalServerError, func(tfc *tfcClient) error {
+			_, err := tfc.FindWorkspaces("idp-test")
+			return err
+		}, clierr.ExitAPI},
+		{"list variables", http.StatusNotFound, func(tfc *tfcClient) error {
+			_, err := tfc.ListVariables("idp-test-stg-core")
+			return err
+		}, clierr.ExitNotFound},
+		{"update workspace", http.StatusUnprocessableEntity, func(tfc *tfcClient) error {
+			return tfc.UpdateWorkspace("idp-test-prod-core", "working-directory", "dir")
+		}, clierr.ExitAPI},
+		{"clone workspace", http.StatusNotFound, func(tfc *tfcClient) error {
+			return tfc.CloneWorkspace("idp-test-prod-core", "idp-test-prod-core-secondary")
+		}, clierr.ExitNotFound},
+		{"find run trigger", http.StatusInternalServerError, func(tfc *tfcClient) error {
+			_, err := tfc.FindRunTrigger("ws-1", "ws-2")
+			return err
+		}, clierr.ExitAPI},
+		{"create run trigger", http.StatusInternalServerError, func(tfc *tfcClient) error {
+			return tfc.CreateRunTrigger("ws-1", "ws-2")
+		}, clierr.ExitAPI},
+		{"add remote state consumers", http.StatusNotFound, func(tfc *tfcClient) error {
+			return tfc.AddRemoteStateConsumers("ws-1", []string{"ws-2"})
+		}, clierr.ExitNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestTfcClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"errors":[{"status":"error"}]}`))
+			}))
+			if got := clierr.ExitCode(err); got != tt.wantExit {
+				t.Errorf("exit code = %d, want %d, err = %v", got, tt.wantExit, err)
+			}
+		})
+	}
+}
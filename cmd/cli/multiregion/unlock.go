@@ -0,0 +1,149 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+	"github.com/silinternational/idp-cli/cmd/cli/flags"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
+)
+
+// UnlockResult is the result of unlocking one workspace
+type UnlockResult struct {
+	Workspace string `json:"workspace" yaml:"workspace"`
+	Unlocked  bool   `json:"unlocked" yaml:"unlocked"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// InitUnlockCmd adds the unlock command. It is a top-level command so that it can be found easily when a multiregion
+// command fails and leaves workspaces locked.
+func InitUnlockCmd(parentCmd *cobra.Command) {
+	var force bool
+
+	unlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Unlock the Terraform workspaces of the IdP",
+		Long: `Unlock all locked Terraform Cloud workspaces of the IdP. The multiregion failover, failback, setup, and dns
+commands lock the workspaces they change and unlock them when they finish. If one of these commands does not finish,
+use this command to remove its locks. A workspace locked by a run in progress cannot be unlocked. Use --force to
+remove a lock held by another user, which requires admin access to the workspace.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			for _, name := range unlockFlags {
+				if err := viper.BindPFlag(unlockFlagKey(name), cmd.Flags().Lookup(name)); err != nil {
+					return outputFlagError(cmd, err)
+				}
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pFlags, err := loadPersistentFlags(unlockParam)
+			if err != nil {
+				return err
+			}
+			return runUnlock(newTerraformCloud(cmd.Context(), pFlags), pFlags, force)
+		},
+	}
+
+	parentCmd.AddCommand(unlockCmd)
+
+	unlockCmd.Flags().String(flags.Env, envProd, "Execution environment")
+	unlockCmd.Flags().String(flags.TfcToken, "", "Token for Terraform Cloud authentication")
+	unlockCmd.Flags().String(flags.WorkspaceNameTemplate, defaultWorkspaceNameTemplate,
+		"Terraform workspace name template, with placeholders {idp}, {env}, {number}, and {name}")
+	unlockCmd.Flags().BoolVar(&force, "force", false, `also remove locks held by other users`)
+}
+
+// unlockFlags are the flags of the unlock command that are also defined on the multiregion command
+var unlockFlags = []string{flags.Env, flags.TfcToken, flags.WorkspaceNameTemplate}
+
+// unlockFlagKey returns the key an unlock command flag is bound to, which is different from the key of the
+// multiregion command flag of the same name so that neither binding replaces the other
+func unlockFlagKey(name string) string {
+	return "unlock-flags." + name
+}
+
+// unlockParam returns the value of a parameter given on the unlock command line, or else from the config file or the
+// root command flags
+func unlockParam(key string) string {
+	if viper.IsSet(unlockFlagKey(key)) {
+		return viper.GetString(unlockFlagKey(key))
+	}
+	return viper.GetString(key)
+}
+
+// runUnlock unlocks every locked workspace of the IdP, after confirmation
+func runUnlock(tfc TerraformCloud, pFlags PersistentFlags, force bool) error {
+	if pFlags.readOnlyMode {
+		_, _ = fmt.Fprintln(pFlags.progress, "-- Read-only mode enabled --")
+	}
+
+	workspaceIDs, err := findIdpWorkspaces(tfc, pFlags)
+	if err != nil {
+		return err
+	}
+
+	var locked []string
+	for _, w := range pFlags.catalog.workspaces {
+		name := workspaceName(pFlags, w.Key)
+		if _, ok := workspaceIDs[name]; !ok {
+			continue
+		}
+		data, err := tfc.GetWorkspace(name)
+		if err != nil {
+			return err
+		}
+		if data.Attributes.Locked {
+			locked = append(locked, name)
+		}
+	}
+
+	if len(locked) == 0 {
+		_, _ = fmt.Fprintln(pFlags.progress, "No workspaces are locked")
+		output.Print([]UnlockResult{})
+		return nil
+	}
+
+	_, _ = fmt.Fprintln(pFlags.progress, "Locked workspaces:")
+	for _, name := range locked {
+		_, _ = fmt.Fprintf(pFlags.progress, "  %s\n", name)
+	}
+
+	results := make([]UnlockResult, len(locked))
+	for i, name := range locked {
+		results[i].Workspace = name
+	}
+	if pFlags.readOnlyMode {
+		output.Print(results)
+		return nil
+	}
+
+	if !confirm(pFlags, "Please confirm unlocking these workspaces.") {
+		return clierr.ErrAborted
+	}
+
+	failed := 0
+	for i, name := range locked {
+		if err := tfc.UnlockWorkspace(workspaceIDs[name], force); err != nil {
+			results[i].Error = err.Error()
+			failed++
+			_, _ = fmt.Fprintf(pFlags.progress, "  %s: FAILED %s\n", name, err)
+			continue
+		}
+		results[i].Unlocked = true
+		_, _ = fmt.Fprintf(pFlags.progress, "  %s: unlocked\n", name)
+	}
+
+	output.Print(results)
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d workspaces could not be unlocked", clierr.ErrPartialFailure, failed,
+			len(locked))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"sync"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+)
+
+// workspaceCache is a TerraformCloud that remembers the ID of each workspace found or read, so that a workspace ID is
+// only looked up once per command. Workspace properties are always read from the wrapped TerraformCloud. It is safe
+// for concurrent use if the wrapped TerraformCloud is.
+type workspaceCache struct {
+	TerraformCloud
+
+	mu sync.Mutex
+
+	// ids is a map of workspace names (key) and IDs (value)
+	ids map[string]string
+}
+
+func newWorkspaceCache(tfc TerraformCloud) *workspaceCache {
+	return &workspaceCache{
+		TerraformCloud: tfc,
+		ids:            map[string]string{},
+	}
+}
+
+func (c *workspaceCache) FindWorkspaces(filter string) (map[string]string, error) {
+	workspaces, err := c.TerraformCloud.FindWorkspaces(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, id := range workspaces {
+		c.ids[name] = id
+	}
+	return workspaces, nil
+}
+
+func (c *workspaceCache) GetWorkspace(name string) (lib.Workspace, error) {
+	w, err := c.TerraformCloud.GetWorkspace(name)
+	if err != nil {
+		return lib.Workspace{}, err
+	}
+	c.store(name, w.ID)
+	return w, nil
+}
+
+// GetWorkspaceID returns the ID of a workspace from the cache, reading the workspace only if it is not cached
+func (c *workspaceCache) GetWorkspaceID(name string) (string, error) {
+	c.mu.Lock()
+	id, ok := c.ids[name]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := c.TerraformCloud.GetWorkspaceID(name)
+	if err != nil {
+		return "", err
+	}
+	c.store(name, id)
+	return id, nil
+}
+
+// DeleteWorkspace deletes a workspace and removes its ID from the cache. The ID is removed after the call, since the
+// wrapped TerraformCloud may look it up in the cache.
+func (c *workspaceCache) DeleteWorkspace(name string) error {
+	err := c.TerraformCloud.DeleteWorkspace(name)
+	c.mu.Lock()
+	delete(c.ids, name)
+	c.mu.Unlock()
+	return err
+}
+
+func (c *workspaceCache) store(name, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[name] = id
+}
@@ -0,0 +1,67 @@
+package multiregion
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/silinternational/tfc-ops/v3/lib"
+)
+
+func TestWorkspaceCache(t *testing.T) {
+	pFlags := testFlags()
+	fake := newTestIdp(pFlags)
+	tfc := newWorkspaceCache(fake)
+	core := workspaceName(pFlags, Core)
+
+	want := fake.workspaces[core].workspace.ID
+	for i := 0; i < 3; i++ {
+		if id, err := getWorkspaceID(tfc, core); err != nil || id != want {
+			t.Fatalf("getWorkspaceID() = %q, %v, want %q", id, err, want)
+		}
+	}
+	if n := fake.workspaceReads.Load(); n != 1 {
+		t.Errorf("workspace was read %d times, want 1", n)
+	}
+
+	// IDs found by a search are cached
+	if _, err := findIdpWorkspaces(tfc, pFlags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getWorkspaceID(tfc, workspaceName(pFlags, Database)); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.workspaceReads.Load(); n != 1 {
+		t.Errorf("workspace was read %d times after a search, want 1", n)
+	}
+}
+
+func TestTfcClientUsesWorkspaceCache(t *testing.T) {
+	var workspaceReads, created atomic.Int32
+	client := newTestTfcClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/organizations/org/workspaces/idp-test-prod-core":
+			workspaceReads.Add(1)
+			_, _ = w.Write([]byte(`{"data":{"id":"ws-1"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/workspaces/ws-1/vars":
+			created.Add(1)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	cache := newWorkspaceCache(client)
+	client.ids = cache
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := cache.CreateVariable("idp-test-prod-core", lib.TFVar{Key: key, Value: "1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := created.Load(); n != 3 {
+		t.Errorf("created %d variables, want 3", n)
+	}
+	if n := workspaceReads.Load(); n != 1 {
+		t.Errorf("workspace was read %d times, want 1", n)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2023 SIL International
+*/
+
+package multiregion
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/viper"
+
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
+)
+
+// availabilityZonesSetting is the config file table that lists the availability zones to use in a region, instead of
+// discovering them. For example:
+//
+//	[availability-zones]
+//	us-west-1 = ["us-west-1a", "us-west-1c"]
+const availabilityZonesSetting = "availability-zones"
+
+// ZoneFinder lists the availability zones of an AWS region
+type ZoneFinder interface {
+	// FindZones returns the names of the available zones in a region, in alphabetical order
+	FindZones(ctx context.Context, region string) ([]string, error)
+}
+
+// ec2ZoneFinder lists availability zones with the EC2 DescribeAvailabilityZones API
+type ec2ZoneFinder struct {
+	cfg aws.Config
+}
+
+func newEc2ZoneFinder(cfg aws.Config) ec2ZoneFinder {
+	return ec2ZoneFinder{cfg: cfg}
+}
+
+func (e ec2ZoneFinder) FindZones(ctx context.Context, region string) ([]string, error) {
+	client := ec2.NewFromConfig(e.cfg, func(o *ec2.Options) { o.Region = region })
+
+	// Local Zones and Wavelength Zones are excluded, only standard availability zones are usable by the cluster
+	out, err := client.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		Filters: []types.Filter{
+			{Name: aws.String("state"), Values: []string{string(types.AvailabilityZoneStateAvailable)}},
+			{Name: aws.String("zone-type"), Values: []string{"availability-zone"}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe availability zones in %s: %w", region, err)
+	}
+
+	zones := make([]string, 0, len(out.AvailabilityZones))
+	for _, z := range out.AvailabilityZones {
+		zones = append(zones, aws.ToString(z.ZoneName))
+	}
+	slices.Sort(zones)
+	return zones, nil
+}
+
+// defaultZoneFinder is an ec2ZoneFinder using the default AWS configuration, which is only loaded when needed
+type defaultZoneFinder struct{}
+
+func (defaultZoneFinder) FindZones(ctx context.Context, region string) ([]string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the AWS configuration: %w", err)
+	}
+	return newEc2ZoneFinder(cfg).FindZones(ctx, region)
+}
+
+// availabilityZones returns the availability zones to use in a region. Zones listed for the region in the
+// availability-zones setting are used as given, otherwise the zones are discovered using the ZoneFinder.
+func availabilityZones(ctx context.Context, finder ZoneFinder, region string) ([]string, error) {
+	if zones := viper.GetStringSlice(availabilityZonesSetting + "." + region); len(zones) > 0 {
+		return zones, nil
+	}
+
+	zones, err := finder.FindZones(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", clierr.ErrAPI, err)
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("%w: no availability zones were found in %s, list them in the %s setting",
+			clierr.ErrConfig, region, availabilityZonesSetting)
+	}
+	return zones, nil
+}
+
+// getZonesHCL returns a list of zones as an HCL list
+func getZonesHCL(zones []string) string {
+	var b strings.Builder
+	b.WriteString("[\n")
+	for _, z := range zones {
+		fmt.Fprintf(&b, "  %q,\n", z)
+	}
+	b.WriteString("]")
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package multiregion
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/viper"
+)
+
+// ec2StandIn is a local HTTP server that implements the EC2 DescribeAvailabilityZones API for a fixed set of zones
+type ec2StandIn struct {
+	*httptest.Server
+
+	// zones is a map of region names (key) and zones (value), including zones that are not standard availability zones
+	zones map[string][]ec2Zone
+}
+
+type ec2Zone struct {
+	Name     string `xml:"zoneName"`
+	State    string `xml:"zoneState"`
+	ZoneType string `xml:"zoneType"`
+}
+
+func newEc2StandIn(t *testing.T, zones map[string][]ec2Zone) *ec2StandIn {
+	s := &ec2StandIn{zones: zones}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "DescribeAvailabilityZones" {
+			t.Errorf("unexpected EC2 request %s %s", r.Method, r.PostForm.Get("Action"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.describeAvailabilityZones(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *ec2StandIn) config() aws.Config {
+	return aws.Config{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(s.URL),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, nil
+		}),
+	}
+}
+
+// describeAvailabilityZones returns the zones matching the request filters. The region is taken from the credential
+// scope of the request signature.
+func (s *ec2StandIn) describeAvailabilityZones(w http.ResponseWriter, r *http.Request) {
+	region := ""
+	for _, part := range strings.Split(r.Header.Get("Authorization"), "/") {
+		if _, ok := s.zones[part]; ok {
+			region = part
+		}
+	}
+
+	filters := map[string]string{}
+	for i := 1; r.PostForm.Has(filterParam(i, "Name")); i++ {
+		filters[r.PostForm.Get(filterParam(i, "Name"))] = r.PostForm.Get(filterParam(i, "Value.1"))
+	}
+
+	type item struct {
+		ec2Zone
+		RegionName string `xml:"regionName"`
+	}
+	var items []item
+	for _, z := range s.zones[region] {
+		if f, ok := filters["state"]; ok && f != z.State {
+			continue
+		}
+		if f, ok := filters["zone-type"]; ok && f != z.ZoneType {
+			continue
+		}
+		items = append(items, item{ec2Zone: z, RegionName: region})
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name `xml:"DescribeAvailabilityZonesResponse"`
+		Xmlns     string   `xml:"xmlns,attr"`
+		RequestID string   `xml:"requestId"`
+		Items     []item   `xml:"availabilityZoneInfo>item"`
+	}{
+		Xmlns:     "http://ec2.amazonaws.com/doc/2016-11-15/",
+		RequestID: "test",
+		Items:     items,
+	})
+}
+
+func filterParam(i int, field string) string {
+	return fmt.Sprintf("Filter.%d.%s", i, field)
+}
+
+func TestEc2ZoneFinder(t *testing.T) {
+	server := newEc2StandIn(t, map[string][]ec2Zone{
+		"us-west-1": {
+			{Name: "us-west-1c", State: "available", ZoneType: "availability-zone"},
+			{Name: "us-west-1a", State: "available", ZoneType: "availability-zone"},
+		},
+		"us-west-2": {
+			{Name: "us-west-2a", State: "available", ZoneType: "availability-zone"},
+			{Name: "us-west-2b", State: "available", ZoneType: "availability-zone"},
+			{Name: "us-west-2-lax-1a", State: "available", ZoneType: "local-zone"},
+			{Name: "us-west-2d", State: "impaired", ZoneType: "availability-zone"},
+		},
+	})
+	finder := newEc2ZoneFinder(server.config())
+
+	tests := map[string][]string{
+		"us-west-1": {"us-west-1a", "us-west-1c"},
+		"us-west-2": {"us-west-2a", "us-west-2b"},
+	}
+	for region, want := range tests {
+		got, err := finder.FindZones(context.Background(), region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s zones = %v, want %v", region, got, want)
+		}
+	}
+
+	// an interrupted command stops looking up zones
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := finder.FindZones(ctx, "us-west-1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestAvailabilityZonesOverride(t *testing.T) {
+	key := availabilityZonesSetting + ".us-west-1"
+	viper.Set(key, []string{"us-west-1b", "us-west-1c"})
+	t.Cleanup(func() { viper.Set(key, nil) })
+
+	if got, _ := availabilityZones(context.Background(), testZones, "us-west-1"); !slices.Equal(got, []string{"us-west-1b", "us-west-1c"}) {
+		t.Errorf("zones = %v, want the configured zones", got)
+	}
+	if got, _ := availabilityZones(context.Background(), testZones, "us-west-2"); !slices.Equal(got, testZones["us-west-2"]) {
+		t.Errorf("zones = %v, want the discovered zones", got)
+	}
+}
+
+func TestSetupZoneVariables(t *testing.T) {
+	pFlags := testFlags()
+	pFlags.secondaryRegion = "us-west-1"
+	tfc := newTestMultiregionIdp(t, pFlags)
+
+	want := "[\n  \"us-west-1a\",\n  \"us-west-1c\",\n]"
+	if got, _ := tfc.variable(workspaceName(pFlags, ClusterSecondary), "aws_zones"); got != want {
+		t.Errorf("aws_zones = %s, want %s", got, want)
+	}
+	if got, _ := tfc.variable(workspaceName(pFlags, DatabaseSecondary), "availability_zone"); got != "us-west-1a" {
+		t.Errorf("availability_zone = %q, want us-west-1a", got)
+	}
+}
@@ -0,0 +1,63 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	Text = "text"
+	JSON = "json"
+	YAML = "yaml"
+)
+
+var format = Text
+
+// Init sets the output format
+func Init(outputFormat string) error {
+	switch outputFormat {
+	case Text, JSON, YAML:
+	default:
+		return fmt.Errorf("invalid output format %q, must be one of %q, %q, or %q", outputFormat, Text, JSON, YAML)
+	}
+	format = outputFormat
+	return nil
+}
+
+// IsText returns true if the output format is plain text
+func IsText() bool {
+	return format == Text
+}
+
+// Progress returns the destination of progress messages and text output. For JSON and YAML, this is os.Stderr so
+// they are kept separate from the structured output written to os.Stdout.
+func Progress() io.Writer {
+	if format == Text {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// Print writes a command result in the JSON or YAML output format. In text mode, nothing is written since the
+// commands print their own text output.
+func Print(result any) {
+	var err error
+	switch format {
+	case JSON:
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		err = e.Encode(result)
+	case YAML:
+		e := yaml.NewEncoder(os.Stdout)
+		e.SetIndent(2)
+		err = e.Encode(result)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Error: failed to write output:", err)
+	}
+}
@@ -4,15 +4,20 @@ Copyright © 2023 SIL International
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/silinternational/idp-cli/cmd/cli/clierr"
 	"github.com/silinternational/idp-cli/cmd/cli/flags"
 	"github.com/silinternational/idp-cli/cmd/cli/multiregion"
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
 const requiredPrefix = "required - "
@@ -25,8 +30,26 @@ func Execute() {
 		Short: "idp-in-a-box CLI",
 		Long: `idp is a CLI tool for the silinternational/idp-in-a-box system.
 It can be used to check the status of the IdP. It can also be used to establish secondary resources
-in a second AWS region, and to initiate a secondary region failover action.`,
+in a second AWS region, and to initiate a secondary region failover action.
+
+Exit codes:
+  0  success
+  1  other error
+  2  configuration error: a required parameter is missing or a parameter or file is not valid
+  3  not found: a workspace, variable, or file does not exist
+  4  API failure: a Terraform Cloud, DNS provider, or AWS request failed
+  5  partial failure: some Terraform runs, DNS records, or workspaces failed
+  6  aborted: the operation was not confirmed, a safety check failed, or it was interrupted`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return output.Init(viper.GetString(flags.Output))
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		cmd.PrintErrln(cmd.UsageString())
+		return fmt.Errorf("%w: %w", clierr.ErrConfig, err)
+	})
 
 	rootCmd.PersistentFlags().StringVar(&configFile, flags.Config, "", "Config file")
 
@@ -34,18 +57,39 @@ in a second AWS region, and to initiate a secondary region failover action.`,
 	flags.NewStringFlag(rootCmd, flags.Idp, "", "", requiredPrefix+"IDP key (short name)")
 	flags.NewStringFlag(rootCmd, flags.Region, "", "", "AWS region")
 	flags.NewBoolFlag(rootCmd, flags.ReadOnlyMode, "r", false, "read-only mode persists no changes")
+	flags.NewStringFlag(rootCmd, flags.Output, "o", output.Text, "output format: text, json, or yaml")
+	flags.NewBoolFlag(rootCmd, flags.Yes, "y", false, "answer yes to all confirmation prompts")
+	flags.NewBoolFlag(rootCmd, flags.NonInteractive, "", false,
+		"never request input, implies --yes, for use in pipelines and automation")
+	multiregion.InitApiFlags(rootCmd)
+	flags.NewStringFlag(rootCmd, flags.AuditLog, "", "", "audit log file, default ~/.config/idp-cli-audit.jsonl")
 
 	SetupVersionCmd(rootCmd)
 	multiregion.SetupMultiregionCmd(rootCmd)
+	multiregion.InitUnlockCmd(rootCmd)
+	multiregion.InitAuditCmd(rootCmd)
 
 	cobra.OnInitialize(initConfig)
 
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	if err := rootCmd.ExecuteContext(interruptContext()); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(clierr.ExitCode(err))
 	}
 }
 
+// interruptContext returns a context that is canceled on the first interrupt signal, e.g. Ctrl-C, so the current API
+// requests are canceled and workspace locks are released before the command exits. A second signal terminates the
+// process immediately.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		_, _ = fmt.Fprintln(os.Stderr, "\nInterrupted, stopping. Press Ctrl-C again to exit immediately.")
+	}()
+	return ctx
+}
+
 // initConfig reads in a Config file and ENV variables if set.
 func initConfig() {
 	if configFile != "" {
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/silinternational/idp-cli/cmd/cli/output"
 )
 
 func SetupVersionCmd(parentCommand *cobra.Command) {
@@ -22,17 +24,21 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show idp-cli version",
 	Run: func(cmd *cobra.Command, args []string) {
-		if version != "" {
-			fmt.Println("Version:", version)
-			return
-		}
-
-		buildInfo, ok := debug.ReadBuildInfo()
-		if ok {
-			fmt.Println("Version:", strings.TrimLeft(buildInfo.Main.Version, "v"))
-			return
-		}
-
-		fmt.Println("Version: unknown")
+		v := getVersion()
+		_, _ = fmt.Fprintln(output.Progress(), "Version:", v)
+		output.Print(map[string]string{"version": v})
 	},
 }
+
+func getVersion() string {
+	if version != "" {
+		return version
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if ok {
+		return strings.TrimLeft(buildInfo.Main.Version, "v")
+	}
+
+	return "unknown"
+}